@@ -23,41 +23,180 @@ import (
 	"go/format"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 const constPrefixHash = "const BundleVersion = "
-const bundleGeneratorVersion = "0.0.1"
+const bundleGeneratorVersion = "0.0.5"
 
 type Options struct {
-	TargetDir            string
-	PackageName          string
-	Include              []string
-	StripPrefixes        []string // removes this prefix from all Include paths, if they begin with it
-	Prefix               string   // attach this prefix to all included files
-	IgnoreRegex          string   // e.g. '.*\.map|^\..*' will ignore all map and hidden files from inclusion
-	DisableCacheUnpacked bool
-	DisableCacheGzip     bool
-	DisableCacheBrotli   bool
+	TargetDir               string            `yaml:"targetDir"`
+	PackageName             string            `yaml:"packageName"`
+	Include                 []string          `yaml:"include"`
+	StripPrefixes           []string          `yaml:"stripPrefixes"` // removes this prefix from all Include paths, if they begin with it
+	Prefix                  string            `yaml:"prefix"`        // attach this prefix to all included files
+	IgnoreRegex             string            `yaml:"ignoreRegex"`   // e.g. '.*\.map|^\..*' will ignore all map and hidden files from inclusion
+	DisableCacheUnpacked    bool              `yaml:"disableCacheUnpacked"`
+	DisableCacheGzip        bool              `yaml:"disableCacheGzip"`
+	DisableCacheBrotli      bool              `yaml:"disableCacheBrotli"`
+	DisableCacheZstd        bool              `yaml:"disableCacheZstd" json:",omitempty"`
+	Codec                   string            `yaml:"codec" json:",omitempty"`                   // registered codec to store the files with, defaults to br
+	Compression             []CompressionRule `yaml:"compression" json:",omitempty"`             // per pattern levels and windows of the codec
+	StoreExtensions         []string          `yaml:"storeExtensions" json:",omitempty"`         // extensions of files embedded without compression, defaults to DefaultStoreExtensions
+	StoreRatio              float64           `yaml:"storeRatio" json:",omitempty"`              // files compressing to more than this fraction of their size are stored, defaults to DefaultStoreRatio, 1 disables
+	EmbedGzip               bool              `yaml:"embedGzip" json:",omitempty"`               // also embed the gzip variant, so that it is never compressed at runtime
+	GzipCodec               string            `yaml:"gzipCodec" json:",omitempty"`               // registered codec producing the embedded gzip variant, e.g. a zopfli implementation, defaults to gzip
+	BlobEncoding            string            `yaml:"blobEncoding" json:",omitempty"`            // ascii85, base64, base122 or raw text encoding of the embedded data, defaults to ascii85
+	ManifestFile            string            `yaml:"manifestFile" json:",omitempty"`            // if set, writes a json manifest of the fingerprinted names, relative to the module root
+	LogLevel                LogLevel          `yaml:"logLevel" json:",omitempty"`                // quiet, normal or verbose, does not affect the generated file
+	Concurrency             int               `yaml:"concurrency" json:",omitempty"`             // amount of files compressed in parallel, defaults to GOMAXPROCS, does not affect the generated file
+	CompressionCacheDir     string            `yaml:"compressionCacheDir" json:",omitempty"`     // persists compressed blobs across runs, defaults to the user cache dir, unused entries are removed after 30 days
+	DisableCompressionCache bool              `yaml:"disableCompressionCache" json:",omitempty"` // always compress all files
+	ModTime                 string            `yaml:"modTime" json:",omitempty"`                 // epoch, source-date-epoch or git replace the modification time of all files
+	NormalizeModes          bool              `yaml:"normalizeModes" json:",omitempty"`          // use 0644 or 0755 instead of the file modes of the checkout
+	OnEvent                 func(e Event)     `yaml:"-" json:"-"`                                // if set, receives all events instead of printing them
 }
 
 // Embed includes the given files or folders and creates a new go src file. It expects a working dir somewhere
 // within a go module and picks the root itself.
 func Embed(opts Options) error {
-	cwd, err := modRoot()
+	return embed(opts, nil)
+}
+
+// embed is like Embed but also folds the given configuration content into the bundle hash, so that a changed
+// configuration file causes a regeneration, even if the resulting options are equal.
+func embed(opts Options, config []byte) error {
+	p, err := newPlan(opts, config)
+	if err != nil {
+		return err
+	}
+
+	foundHash, err := extractFileHash(p.targetFile)
 	if err != nil {
 		return err
 	}
 
-	ignoreRegex, err := regexp.Compile(opts.IgnoreRegex)
+	if p.requiredHash == foundHash {
+		opts.emit(Event{Kind: EventSkipped, File: p.targetFile})
+		return p.syncManifest() // the manifest may have been deleted independently
+	}
+
+	src, formatted, err := p.generate()
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("working dir", cwd)
+	return p.write(src, formatted, "")
+}
+
+// plan contains the resolved inputs of a single generator run.
+type plan struct {
+	cwd          string
+	opts         Options
+	files        []string   // absolute and sorted file names
+	modTime      *time.Time // replaces the modification time of all files, if not nil
+	codec        Codec      // compresses the stored data
+	gzipCodec    Codec      // compresses the embedded gzip variant, nil if none
+	encoding     string     // text encoding of the blobs
+	rules        []ruleCodec
+	requiredHash string
+	targetFile   string
+}
+
+// newPlan resolves all included files and calculates the hash, which identifies the generated file.
+func newPlan(opts Options, config []byte) (*plan, error) {
+	cwd, err := modRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := collectFiles(cwd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		opts.emit(Event{Kind: EventDiscovered, File: file, Size: stat.Size()})
+	}
+
+	p := &plan{
+		cwd:        cwd,
+		opts:       opts,
+		files:      files,
+		targetFile: filepath.Clean(filepath.Join(cwd, opts.TargetDir, "bundle.gen.go")),
+	}
+
+	hashOpts := opts
+	hashOpts.LogLevel = LogNormal // logging, concurrency and caching do not change the generated file
+	hashOpts.Concurrency = 0
+	hashOpts.CompressionCacheDir = ""
+	hashOpts.DisableCompressionCache = false
+
+	p.requiredHash, err = fileHash(files, p.nameOf, hashOpts, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.modTime, err = resolveModTime(cwd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	codecName := opts.Codec
+	if codecName == "" {
+		codecName = DefaultCodec
+	}
+
+	var ok bool
+	p.codec, ok = LookupCodec(codecName)
+	if !ok {
+		return nil, fmt.Errorf("codec '%s' is not registered, available are %s", codecName, strings.Join(Codecs(), ", "))
+	}
+
+	p.encoding, err = resolveBlobEncoding(opts.BlobEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	p.rules, err = resolveCompression(p.codec, opts.Compression, p.encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.EmbedGzip && codecName != EncodingGzip {
+		gzipName := opts.GzipCodec
+		if gzipName == "" {
+			gzipName = EncodingGzip
+		}
+
+		if p.gzipCodec, ok = LookupCodec(gzipName); !ok {
+			return nil, fmt.Errorf("gzip codec '%s' is not registered, available are %s", gzipName, strings.Join(Codecs(), ", "))
+		}
+	}
+
+	return p, nil
+}
+
+// collectFiles returns all included files, which are not ignored.
+func collectFiles(cwd string, opts Options) ([]string, error) {
+	var ignoreRegex *regexp.Regexp
+	if opts.IgnoreRegex != "" {
+		var err error
+		ignoreRegex, err = regexp.Compile(opts.IgnoreRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var files []string
 	for _, inc := range opts.Include {
 		fname := filepath.Clean(inc)
@@ -67,13 +206,13 @@ func Embed(opts Options) error {
 
 		stat, err := os.Stat(fname)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if stat.IsDir() {
 			fnames, err := scan(fname, ignoreRegex)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			files = append(files, fnames...)
 		} else {
@@ -81,73 +220,155 @@ func Embed(opts Options) error {
 		}
 	}
 
-	totalSize, err := stat(files)
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("found %d files, total %d bytes (%fMB)\n", len(files), totalSize, float32(totalSize)/1024/1024)
+	return files, nil
+}
 
-	requiredHash, err := fileHash(files, opts)
-	if err != nil {
-		return err
+// nameOf returns the resource name of the given file, i.e. the path relative to the module root without the
+// first matching strip prefix and with the optional prefix attached.
+func (p *plan) nameOf(file string) string {
+	stripPrefixes := p.opts.StripPrefixes
+	if stripPrefixes == nil {
+		stripPrefixes = []string{p.cwd}
 	}
 
-	targetGenFile := filepath.Clean(filepath.Join(cwd, opts.TargetDir, "bundle.gen.go"))
-	foundHash, err := extractFileHash(targetGenFile)
+	name, err := filepath.Rel(p.cwd, file)
 	if err != nil {
-		return err
+		panic(err)
 	}
-
-	if requiredHash == foundHash {
-		fmt.Println("bundle is already up to date, nothing to do")
-		return nil
+	name = "/" + name
+	for _, strip := range stripPrefixes {
+		if strings.HasPrefix(name, strip) {
+			name = name[len(strip):]
+			if !strings.HasPrefix(name, "/") {
+				name = "/" + name
+			}
+			break
+		}
 	}
 
-	if opts.StripPrefixes == nil {
-		opts.StripPrefixes = []string{cwd}
+	if p.opts.Prefix != "" {
+		name = path.Join("/", p.opts.Prefix, name)
 	}
 
+	return name
+}
+
+// generate compresses all files and returns the formatted go source.
+func (p *plan) generate() (*srcFile, []byte, error) {
 	src := &srcFile{
-		PackageName: opts.PackageName,
-		Version:     requiredHash,
+		PackageName: p.opts.PackageName,
+		Version:     p.requiredHash,
 	}
 
-	for _, file := range files {
-		name, err := filepath.Rel(cwd, file)
+	files := make([]*fileInput, len(p.files))
+	err := forEach(len(p.files), p.opts.concurrency(), func(i int) error {
+		source, err := filepath.Rel(p.cwd, p.files[i])
 		if err != nil {
-			panic(err)
-		}
-		name = "/" + name
-		for _, strip := range opts.StripPrefixes {
-			if strings.HasPrefix(name, strip) {
-				name = name[len(strip):]
-				if !strings.HasPrefix(name, "/") {
-					name = "/" + name
-				}
-				break
-			}
+			return err
 		}
 
-		err = src.addFile(file, name, opts)
+		files[i], err = readFile(p.files[i], p.nameOf(p.files[i]), filepath.ToSlash(source))
 		if err != nil {
 			return err
 		}
+
+		if p.modTime != nil {
+			files[i].modTime = *p.modTime
+		}
+
+		if p.opts.NormalizeModes {
+			files[i].mode = normalizeMode(files[i].mode)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := src.addFiles(files, p); err != nil {
+		return nil, nil, err
 	}
 
 	tmp := &bytes.Buffer{}
 	err = goTpl.Execute(tmp, src)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	formatted, err := format.Source(tmp.Bytes())
 	if err != nil {
-		fmt.Println(string(tmp.Bytes()))
+		return nil, nil, fmt.Errorf("cannot format generated source: %w", err)
+	}
+
+	return src, formatted, nil
+}
+
+// write writes the generated go source and the optional manifest. The details are attached to the
+// EventWritten of the go source.
+func (p *plan) write(src *srcFile, formatted []byte, details string) error {
+	err := ioutil.WriteFile(p.targetFile, formatted, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	p.opts.emit(Event{Kind: EventWritten, File: p.targetFile, Size: int64(len(formatted)), Details: details})
+
+	if p.opts.ManifestFile != "" {
+		return p.writeManifest(encodeManifest(src.manifest()))
+	}
+
+	return nil
+}
+
+// manifestFile returns the absolute name of the configured manifest file.
+func (p *plan) manifestFile() string {
+	return filepath.Join(p.cwd, p.opts.ManifestFile)
+}
+
+// expectedManifest returns the manifest of the planned resources, without compressing anything.
+func (p *plan) expectedManifest() ([]byte, error) {
+	hashes, err := p.resourceHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]string, len(hashes))
+	for name, sha256 := range hashes {
+		addManifestEntry(manifest, name, sha256)
+	}
+
+	return encodeManifest(manifest), nil
+}
+
+// syncManifest writes the configured manifest file of an up to date generated file, if it is missing or differs.
+func (p *plan) syncManifest() error {
+	if p.opts.ManifestFile == "" {
+		return nil
+	}
+
+	buf, err := p.expectedManifest()
+	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(targetGenFile, formatted, os.ModePerm)
+	return p.writeManifest(buf)
+}
+
+// writeManifest writes the manifest file, unless it already has the given content.
+func (p *plan) writeManifest(buf []byte) error {
+	fname := p.manifestFile()
+	if old, err := ioutil.ReadFile(fname); err == nil && bytes.Equal(old, buf) {
+		return nil
+	}
+
+	if err := ioutil.WriteFile(fname, buf, os.ModePerm); err != nil {
+		return err
+	}
+
+	p.opts.emit(Event{Kind: EventWritten, File: fname, Size: int64(len(buf))})
+	return nil
 }
 
 func modRoot() (string, error) {
@@ -168,7 +389,9 @@ func modRoot() (string, error) {
 	}
 }
 
-func fileHash(files []string, opts interface{}) (string, error) {
+// fileHash returns the hash of the given files, their resource names, the options and the extra data. Names and
+// lengths delimit the files, so that a renamed file or content moved between files changes the hash.
+func fileHash(files []string, nameOf func(file string) string, opts interface{}, extra ...[]byte) (string, error) {
 	sort.Strings(files)
 	hash := sha256.New()
 	for _, file := range files {
@@ -176,6 +399,7 @@ func fileHash(files []string, opts interface{}) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		fmt.Fprintf(hash, "%q %d\n", nameOf(file), len(buf))
 		_, err = hash.Write(buf)
 		if err != nil {
 			return "", err
@@ -191,23 +415,14 @@ func fileHash(files []string, opts interface{}) (string, error) {
 			return "", err
 		}
 	}
+	for _, buf := range extra {
+		hash.Write(buf)
+	}
 	hash.Write([]byte(bundleGeneratorVersion))
 
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func stat(files []string) (int64, error) {
-	sum := int64(0)
-	for _, file := range files {
-		stat, err := os.Stat(file)
-		if err != nil {
-			return 0, err
-		}
-		sum += stat.Size()
-	}
-	return sum, nil
-}
-
 func extractFileHash(fname string) (string, error) {
 	if _, err := os.Stat(fname); err != nil {
 		return "", nil
@@ -244,7 +459,7 @@ func scan(dir string, expIgnore *regexp.Regexp) ([]string, error) {
 			return filepath.SkipDir
 		}
 
-		if info.Mode().IsRegular() && !expIgnore.MatchString(info.Name()) {
+		if info.Mode().IsRegular() && (expIgnore == nil || !expIgnore.MatchString(info.Name())) {
 			r = append(r, path)
 		}
 
@@ -0,0 +1,196 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// blobSettings identifies the compression and text encoding of the generated blobs. It is part of the cache
+// key, so that changed settings never pick up stale entries.
+func blobSettings(codec Codec, level, window int, encoding string) string {
+	if level == 0 && window == 0 {
+		return codec.Name() + "-best+" + encoding
+	}
+	return fmt.Sprintf("%s-l%d-w%d+%s", codec.Name(), level, window, encoding)
+}
+
+// The blob cache removes entries, which have not been used for cacheTrimAge, at most once per
+// cacheTrimInterval. The entire directory can be deleted at any time.
+const (
+	cacheTrimAge      = 30 * 24 * time.Hour
+	cacheTrimInterval = 24 * time.Hour
+	cacheTouchAge     = time.Hour // the modification time of used entries is updated at this resolution
+)
+
+// blobCache persists compressed and encoded blobs across generator runs. Entries are immutable, because
+// their key contains the content hash and the codec settings. Each entry starts with a header line of the
+// compressed size and the sha256 of the encoded blob, so that damaged entries are detected. A nil *blobCache
+// is a valid disabled cache.
+type blobCache struct {
+	dir string
+}
+
+// newBlobCache returns the cache configured by the options or nil, if it has been disabled or no
+// directory can be determined.
+func newBlobCache(opts Options) *blobCache {
+	if opts.DisableCompressionCache {
+		return nil
+	}
+
+	dir := opts.CompressionCacheDir
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil
+		}
+		dir = filepath.Join(userDir, "golangee-bundle")
+	}
+
+	return &blobCache{dir: dir}
+}
+
+// file returns the name of the entry for the given content hash and codec settings.
+func (c *blobCache) file(hash [32]byte, codec string) string {
+	key := sha256.Sum256(append([]byte(codec+":"), hash[:]...))
+	name := hex.EncodeToString(key[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// get returns the encoded blob and the size of the compressed data. Missing or damaged entries are
+// reported as a miss, so that they are overwritten by put.
+func (c *blobCache) get(hash [32]byte, codec string) (data string, compressed int64, ok bool) {
+	if c == nil {
+		return "", 0, false
+	}
+
+	fname := c.file(hash, codec)
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return "", 0, false
+	}
+
+	header, body, found := cutLine(buf)
+	if !found {
+		return "", 0, false
+	}
+
+	var checksum string
+	if _, err := fmt.Sscanf(string(header), "%d %s", &compressed, &checksum); err != nil || compressed < 0 {
+		return "", 0, false
+	}
+
+	sum := sha256.Sum256(body)
+	if checksum != hex.EncodeToString(sum[:]) {
+		return "", 0, false
+	}
+
+	if stat, err := os.Stat(fname); err == nil && time.Since(stat.ModTime()) > cacheTouchAge {
+		now := time.Now()
+		os.Chtimes(fname, now, now) // keep used entries from being trimmed, failing is harmless
+	}
+
+	return string(body), compressed, true
+}
+
+// put stores the encoded blob. The entry is written to a temporary file and renamed, so that concurrent
+// generator runs never observe partial entries.
+func (c *blobCache) put(hash [32]byte, codec string, data string, compressed int64) error {
+	if c == nil {
+		return nil
+	}
+
+	fname := c.file(hash, codec)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return fmt.Errorf("compression cache: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("compression cache: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "%d %s\n", compressed, hex.EncodeToString(sum[:]))
+	w.WriteString(data)
+	err = w.Flush()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), fname)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("compression cache: %w", err)
+	}
+
+	return nil
+}
+
+// trim removes all entries and left over temporary files, which have not been used for cacheTrimAge, unless
+// the cache has already been trimmed within the last cacheTrimInterval.
+func (c *blobCache) trim() error {
+	if c == nil {
+		return nil
+	}
+
+	now := time.Now()
+	marker := filepath.Join(c.dir, "trim.txt")
+	if stat, err := os.Stat(marker); err == nil && now.Sub(stat.ModTime()) < cacheTrimInterval {
+		return nil
+	}
+
+	entries, err := filepath.Glob(filepath.Join(c.dir, "??", "*"))
+	if err != nil {
+		return fmt.Errorf("compression cache: %w", err)
+	}
+
+	for _, entry := range entries {
+		if stat, err := os.Stat(entry); err == nil && now.Sub(stat.ModTime()) > cacheTrimAge {
+			os.Remove(entry) // a concurrent generator run may have removed it already
+		}
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("compression cache: %w", err)
+	}
+
+	if err := ioutil.WriteFile(marker, []byte(strconv.FormatInt(now.Unix(), 10)), 0644); err != nil {
+		return fmt.Errorf("compression cache: %w", err)
+	}
+
+	return nil
+}
+
+// cutLine splits buf at the first line feed.
+func cutLine(buf []byte) (line, rest []byte, found bool) {
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		return buf[:i], buf[i+1:], true
+	}
+	return buf, nil, false
+}
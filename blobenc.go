@@ -0,0 +1,245 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// The supported values of Options.BlobEncoding, which determine how the binary blobs are represented as string
+// constants. The overhead is given for random, i.e. compressed, data. Denser encodings create smaller sources,
+// but the compiler has to process and the runtime has to decode them anyway.
+const (
+	// BlobAscii85 uses ascii85 in a quoted string literal, with 25% overhead. This is the default.
+	BlobAscii85 = "ascii85"
+	// BlobBase64 uses the standard base64 alphabet in a quoted string literal, with 33% overhead.
+	BlobBase64 = "base64"
+	// BlobBase122 uses a base-122 variant in a raw string literal, with around 14% overhead. Like the original
+	// (see http://blog.kevinalbs.com/base122), it encodes 7 bits per byte and the characters, which must
+	// not appear in a raw string literal (NUL, carriage return and back quote), with 2 byte UTF-8 sequences.
+	BlobBase122 = "base122"
+	// BlobRaw uses a raw string literal, which contains ASCII and valid UTF-8 sequences as is. Only NUL, carriage
+	// return, back quote and other bytes are escaped as 2 byte UTF-8 sequences, with around 45% overhead for
+	// random data. It is the densest encoding for stored text files.
+	BlobRaw = "raw"
+)
+
+// resolveBlobEncoding validates the encoding and replaces the empty one by the default.
+func resolveBlobEncoding(encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return BlobAscii85, nil
+	case BlobAscii85, BlobBase64, BlobBase122, BlobRaw:
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("unsupported blobEncoding '%s', expected %s, %s, %s or %s", encoding, BlobAscii85,
+			BlobBase64, BlobBase122, BlobRaw)
+	}
+}
+
+// mustEncodeBlob panics, if the encoding is not supported
+func mustEncodeBlob(encoding string, buf []byte) string {
+	switch encoding {
+	case "", BlobAscii85:
+		return mustEncodeAscii85(buf)
+	case BlobBase64:
+		return base64.StdEncoding.EncodeToString(buf)
+	case BlobBase122:
+		return encodeBase122(buf)
+	case BlobRaw:
+		return encodeRaw(buf)
+	default:
+		panic(fmt.Sprintf("unsupported blob encoding '%s'", encoding))
+	}
+}
+
+// mustDecodeBlob panics, if str cannot be decoded
+func mustDecodeBlob(encoding string, str string) []byte {
+	switch encoding {
+	case "", BlobAscii85:
+		return mustDecodeAscii85(str)
+	case BlobBase64:
+		return mustDecodeBase64(str)
+	case BlobBase122:
+		return mustDecodeBase122(str)
+	case BlobRaw:
+		return decodeRaw(str)
+	default:
+		panic(fmt.Sprintf("unsupported blob encoding '%s'", encoding))
+	}
+}
+
+// blobLiteral returns the go string literal of the encoded blob.
+func blobLiteral(encoding string, str string) string {
+	switch encoding {
+	case BlobBase122, BlobRaw:
+		return "`" + str + "`"
+	default:
+		return strconv.Quote(str)
+	}
+}
+
+// rawIllegal returns true for characters, which cannot appear in a raw string literal.
+func rawIllegal(c byte) bool {
+	return c == 0 || c == '\r' || c == '`'
+}
+
+// base122Illegals are the 7 bit values, which are encoded with the following 7 bits as a 2 byte sequence. The
+// index 7 marks the last value, which has no following bits.
+var base122Illegals = [...]byte{0, '\r', '`'}
+
+const base122Shortened = 7
+
+func encodeBase122(buf []byte) string {
+	res := make([]byte, 0, len(buf)*8/7+2)
+	bit := 0 // position in buf in bits
+	next7 := func() (byte, bool) {
+		if bit >= len(buf)*8 {
+			return 0, false
+		}
+
+		i, shift := bit/8, bit%8
+		v := uint16(buf[i]) << 8
+		if i+1 < len(buf) {
+			v |= uint16(buf[i+1])
+		}
+		bit += 7
+		return byte(v>>(9-shift)) & 0x7f, true
+	}
+
+	for {
+		bits, ok := next7()
+		if !ok {
+			break
+		}
+
+		illegal := -1
+		for i, c := range base122Illegals {
+			if bits == c {
+				illegal = i
+				break
+			}
+		}
+
+		if illegal < 0 {
+			res = append(res, bits)
+			continue
+		}
+
+		following, ok := next7()
+		if !ok {
+			illegal = base122Shortened
+			following = bits
+		}
+
+		res = append(res, 0xc2|byte(illegal)<<2|following>>6, 0x80|following&0x3f)
+	}
+
+	return string(res)
+}
+
+// mustDecodeBase122 panics, if str contains an invalid sequence
+func mustDecodeBase122(str string) []byte {
+	res := make([]byte, 0, len(str)*7/8)
+	var acc uint16 // pending bits, right aligned
+	var n uint     // amount of pending bits
+	push7 := func(bits byte) {
+		acc = acc<<7 | uint16(bits)
+		n += 7
+		if n >= 8 {
+			n -= 8
+			res = append(res, byte(acc>>n))
+		}
+	}
+
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c < 0x80 {
+			push7(c)
+			continue
+		}
+
+		if i+1 >= len(str) {
+			panic("base122: truncated sequence")
+		}
+
+		illegal := c >> 2 & 7
+		if illegal != base122Shortened {
+			if int(illegal) >= len(base122Illegals) {
+				panic("base122: invalid sequence")
+			}
+			push7(base122Illegals[illegal])
+		}
+
+		i++
+		push7((c&1)<<6 | str[i]&0x3f)
+	}
+
+	return res
+}
+
+// rawEscape is the first rune of the 2 byte UTF-8 sequences, which encode escaped single bytes. Valid input
+// sequences of runes from this range are escaped as well, so that decoding is unambiguous.
+const rawEscape = 0x100
+
+func encodeRaw(buf []byte) string {
+	res := make([]byte, 0, len(buf))
+	for i := 0; i < len(buf); {
+		c := buf[i]
+		if c < utf8.RuneSelf && !rawIllegal(c) {
+			res = append(res, c)
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(buf[i:])
+		if size > 1 && (r < rawEscape || r > rawEscape+0xff) && r != '\uFEFF' {
+			res = append(res, buf[i:i+size]...)
+			i += size
+			continue
+		}
+
+		r = rawEscape + rune(c)
+		res = append(res, 0xc0|byte(r>>6), 0x80|byte(r)&0x3f)
+		i++
+	}
+
+	return string(res)
+}
+
+func decodeRaw(str string) []byte {
+	res := make([]byte, 0, len(str))
+	for i := 0; i < len(str); {
+		c := str[i]
+		if c < utf8.RuneSelf {
+			res = append(res, c)
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(str[i:])
+		if r >= rawEscape && r <= rawEscape+0xff {
+			res = append(res, byte(r-rawEscape))
+		} else {
+			res = append(res, str[i:i+size]...)
+		}
+		i += size
+	}
+
+	return res
+}
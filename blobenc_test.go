@@ -0,0 +1,160 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var blobEncodings = []string{BlobAscii85, BlobBase64, BlobBase122, BlobRaw}
+
+// blobInputs returns edge cases and random data for the blob encodings.
+func blobInputs() map[string][]byte {
+	inputs := map[string][]byte{
+		"empty":           {},
+		"nul":             {0},
+		"nuls":            {0, 0, 0, 0, 0, 0, 0, 0, 0},
+		"cr":              {'\r'},
+		"crlf":            []byte("a\r\nb\r\n"),
+		"back quote":      []byte("`x``"),
+		"bom":             []byte("\xef\xbb\xbf"),
+		"bom in text":     []byte("a\xef\xbb\xbfb"),
+		"escape runes":    []byte("Āāſƀǿ"),
+		"around escapes":  []byte("ÿȀ߿"),
+		"text":            []byte("Grüße, 世界 \U0001f600\n\ttab"),
+		"invalid utf-8":   {0xff, 0xfe, 0xc4, 0x80, 0xc0, 0x80, 0xed, 0xa0, 0x80, 0xf4, 0x90, 0x80, 0x80},
+		"truncated utf-8": {'a', 0xe4, 0xb8},
+		"high bytes":      {0x80, 0x81, 0xbf, 0xc0, 0xc2, 0xde, 0xdf, 0xfe, 0xff},
+		// 56 bits, whose last 7 bit chunk is illegal without following bits
+		"shortened": {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x80},
+		// the last chunk is a padded back quote
+		"shortened back quote": {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xe0},
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		buf := make([]byte, r.Intn(64))
+		r.Read(buf)
+		inputs["random "+strconv.Itoa(i)] = buf
+
+		// mostly illegal characters, to hit 2 byte sequences at all positions
+		illegal := make([]byte, r.Intn(32))
+		for j := range illegal {
+			illegal[j] = []byte{0, '\r', '`', 0xc0, 0x7f}[r.Intn(5)]
+		}
+		inputs["illegal "+strconv.Itoa(i)] = illegal
+	}
+
+	large := make([]byte, 1<<16)
+	r.Read(large)
+	inputs["large"] = large
+
+	return inputs
+}
+
+func TestBlobEncodingRoundTrip(t *testing.T) {
+	for _, encoding := range blobEncodings {
+		for name, buf := range blobInputs() {
+			str := mustEncodeBlob(encoding, buf)
+			if got := mustDecodeBlob(encoding, str); !bytes.Equal(got, buf) {
+				t.Fatalf("%s %s: expected %x but got %x", encoding, name, buf, got)
+			}
+		}
+	}
+}
+
+func TestBlobLiteral(t *testing.T) {
+	for _, encoding := range blobEncodings {
+		for name, buf := range blobInputs() {
+			str := mustEncodeBlob(encoding, buf)
+			if !utf8.ValidString(str) {
+				t.Fatalf("%s %s: invalid UTF-8 %q", encoding, name, str)
+			}
+
+			if strings.ContainsAny(str, "\x00\r\ufeff") || (literalRaw(encoding) && strings.Contains(str, "`")) {
+				t.Fatalf("%s %s: illegal character in %q", encoding, name, str)
+			}
+
+			// the go parser rejects anything, which is not a valid literal
+			literal := blobLiteral(encoding, str)
+			file, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\nconst c = "+literal+"\n", 0)
+			if err != nil {
+				t.Fatalf("%s %s: %v", encoding, name, err)
+			}
+
+			lit := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0].(*ast.BasicLit)
+			if got, err := strconv.Unquote(lit.Value); err != nil || got != str {
+				t.Fatalf("%s %s: literal %s does not unquote to the encoded blob: %v", encoding, name, literal, err)
+			}
+		}
+	}
+}
+
+// literalRaw returns true for the encodings, which are embedded as raw string literals.
+func literalRaw(encoding string) bool {
+	return encoding == BlobBase122 || encoding == BlobRaw
+}
+
+func TestBase122Shortened(t *testing.T) {
+	for _, buf := range [][]byte{{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x80}, {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xe0}} {
+		str := encodeBase122(buf)
+		if len(str) != 9 || str[7]>>2&7 != base122Shortened {
+			t.Fatalf("expected 7 single bytes and a shortened sequence but got %x", str)
+		}
+
+		if got := mustDecodeBase122(str); !bytes.Equal(got, buf) {
+			t.Fatalf("expected %x but got %x", buf, got)
+		}
+	}
+}
+
+func TestBlobEncodingOverhead(t *testing.T) {
+	buf := make([]byte, 1<<16)
+	rand.New(rand.NewSource(2)).Read(buf)
+
+	limits := map[string]float64{BlobAscii85: 1.26, BlobBase64: 1.34, BlobBase122: 1.15, BlobRaw: 1.5}
+	for _, encoding := range blobEncodings {
+		ratio := float64(len(mustEncodeBlob(encoding, buf))) / float64(len(buf))
+		if ratio > limits[encoding] {
+			t.Errorf("%s: expected an overhead ratio below %.2f but got %.3f", encoding, limits[encoding], ratio)
+		}
+	}
+
+	text := []byte(strings.Repeat("Grüße, `bundle`\n", 100))
+	if len(encodeRaw(text)) > len(text)+2*strings.Count(string(text), "`") {
+		t.Errorf("raw must only escape back quotes in text")
+	}
+}
+
+func TestMustDecodeBase122Invalid(t *testing.T) {
+	for _, str := range []string{"\xc2", "ab\xde", "\xd2\x80"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic for %q", str)
+				}
+			}()
+			mustDecodeBase122(str)
+		}()
+	}
+}
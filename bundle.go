@@ -22,21 +22,28 @@ import (
 // Bundle contains a bunch of resources.
 type Bundle struct {
 	resources []*Resource
+	dev       *devMode // nil, if not in development mode
 }
 
 // Make creates a new bundle from the given resources. We use Make here to avoid
-// stuttering like bundle.NewBundle(). Takes ownership of resources.
+// stuttering like bundle.NewBundle(). Takes ownership of resources. If the environment variable
+// BUNDLE_DEV is set, the bundle is in development mode, see also Bundle.Dev.
 func Make(resources ...*Resource) *Bundle {
 	b := &Bundle{
 		resources: resources,
+		dev:       devModeFromEnv(),
 	}
 	b.sort()
 	return b
 }
 
-// Handler returns a new http handler, providing resources for the given prefix
-func (b *Bundle) Handler(prefix string) func(http.ResponseWriter, *http.Request) {
-	return Handle(prefix, b.resources...)
+// Handler returns a new http handler, providing resources for the given prefix. The behavior can be
+// customized using options, e.g. b.Handler("/", WithCacheControl("no-store"), WithNotFound("/404.html")).
+func (b *Bundle) Handler(prefix string, opts ...HandlerOption) http.Handler {
+	if b.dev != nil {
+		opts = append([]HandlerOption{withDev(b.dev)}, opts...)
+	}
+	return newHandler(prefix, b.resources, opts...)
 }
 
 // Put returns a new bundle instance with the given resource replacing any other resource
@@ -47,11 +54,11 @@ func (b *Bundle) Put(resource *Resource) *Bundle {
 		tmp := make([]*Resource, len(b.resources))
 		copy(tmp, b.resources)
 		tmp[idx] = resource
-		return Make(tmp...)
+		return b.derive(tmp)
 	}
 
 	tmp := append(b.resources[:idx], append([]*Resource{resource}, b.resources[idx:]...)...)
-	return Make(tmp...)
+	return b.derive(tmp)
 }
 
 // Remove tries to delete the resource from the bundle and returns a new potentionally modified instance.
@@ -59,7 +66,7 @@ func (b *Bundle) Remove(name string) *Bundle {
 	idx, _ := b.find(name)
 	if idx >= 0 {
 		tmp := b.resources[:idx+copy(b.resources[idx:], b.resources[idx+1:])]
-		return Make(tmp...)
+		return b.derive(tmp)
 	}
 	return b
 }
@@ -67,6 +74,13 @@ func (b *Bundle) Remove(name string) *Bundle {
 // Find returns the resource or nil
 func (b *Bundle) Find(name string) *Resource {
 	_, res := b.find(name)
+	return b.refresh(res)
+}
+
+// derive creates a new bundle from the given resources, keeping the development mode.
+func (b *Bundle) derive(resources []*Resource) *Bundle {
+	res := Make(resources...)
+	res.dev = b.dev
 	return res
 }
 
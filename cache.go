@@ -0,0 +1,149 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minFingerprintLen is the minimal amount of hex digits of the sha256 hash, which must be part of a resource name
+// to be considered as fingerprinted.
+const minFingerprintLen = 8
+
+// ImmutablePolicy is applied to fingerprinted resources, whose content can never change for the same name.
+var ImmutablePolicy = CachePolicy{Public: true, MaxAge: 365 * 24 * time.Hour, Immutable: true}
+
+// CachePolicy describes the directives of a Cache-Control response header.
+type CachePolicy struct {
+	Public               bool
+	Private              bool
+	NoStore              bool
+	NoCache              bool
+	MaxAge               time.Duration
+	StaleWhileRevalidate time.Duration
+	Immutable            bool
+}
+
+// String returns the Cache-Control header value, e.g. "public, max-age=31536000, immutable".
+func (p CachePolicy) String() string {
+	var directives []string
+	if p.Public {
+		directives = append(directives, "public")
+	}
+
+	if p.Private {
+		directives = append(directives, "private")
+	}
+
+	if p.NoStore {
+		directives = append(directives, "no-store")
+	}
+
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+
+	if p.MaxAge > 0 || p.Immutable {
+		directives = append(directives, "max-age="+strconv.FormatInt(int64(p.MaxAge/time.Second), 10))
+	}
+
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+strconv.FormatInt(int64(p.StaleWhileRevalidate/time.Second), 10))
+	}
+
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// cacheRule relates a resource name matcher with a policy.
+type cacheRule struct {
+	match  func(name string) bool
+	policy string
+}
+
+// WithCacheRule applies the policy to all resources matching the glob pattern (see path.Match). A pattern
+// containing a slash is matched against the entire resource name like /assets/*.js, otherwise only against
+// the base name like *.js. Rules are evaluated in the order given and the first match wins. It panics, if the
+// pattern is malformed.
+func WithCacheRule(pattern string, policy CachePolicy) HandlerOption {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(err)
+	}
+
+	rule := cacheRule{
+		match: func(name string) bool {
+			return matchGlob(pattern, name)
+		},
+		policy: policy.String(),
+	}
+
+	return func(h *handler) {
+		h.cacheRules = append(h.cacheRules, rule)
+	}
+}
+
+// WithCacheRuleRegex is like WithCacheRule but matches the entire resource name using a regular expression.
+// It panics, if the expression is invalid.
+func WithCacheRuleRegex(expr string, policy CachePolicy) HandlerOption {
+	regex := regexp.MustCompile(expr)
+	rule := cacheRule{
+		match:  regex.MatchString,
+		policy: policy.String(),
+	}
+
+	return func(h *handler) {
+		h.cacheRules = append(h.cacheRules, rule)
+	}
+}
+
+// cachePolicy returns the Cache-Control value for the resource requested by the given name, which may be
+// a fingerprinted alias. Without a matching rule, fingerprinted names are immutable and everything else uses
+// the handlers default.
+func (h *handler) cachePolicy(name string, resource *Resource) string {
+	for _, rule := range h.cacheRules {
+		if rule.match(name) {
+			return rule.policy
+		}
+	}
+
+	if isFingerprinted(name, resource.sha256String) {
+		return ImmutablePolicy.String()
+	}
+
+	return h.cacheControl
+}
+
+// isFingerprinted reports whether the base name contains a segment like app.3f9a1c2e.js or app-3f9a1c2e.js,
+// which is a prefix of its own hex encoded content hash.
+func isFingerprinted(name string, sha256 string) bool {
+	segments := strings.FieldsFunc(path.Base(name), func(r rune) bool {
+		return r == '.' || r == '-' || r == '_'
+	})
+
+	for _, segment := range segments {
+		if len(segment) >= minFingerprintLen && strings.HasPrefix(sha256, strings.ToLower(segment)) {
+			return true
+		}
+	}
+
+	return false
+}
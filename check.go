@@ -0,0 +1,247 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// StaleReason describes why a generated file does not match its inputs.
+type StaleReason int
+
+const (
+	// StaleMissing denotes that the generated file does not exist.
+	StaleMissing StaleReason = iota + 1
+	// StaleOutdated denotes that files, options or the generator have changed since the last generation.
+	StaleOutdated
+	// StaleModified denotes that the generated file has been edited by hand. Because its bundle version is still
+	// valid, Embed does not regenerate it until it is deleted. A modified manifest is rewritten by Embed.
+	StaleModified
+)
+
+func (r StaleReason) String() string {
+	switch r {
+	case StaleMissing:
+		return "missing"
+	case StaleOutdated:
+		return "out of date"
+	case StaleModified:
+		return "modified by hand"
+	default:
+		return fmt.Sprintf("StaleReason(%d)", int(r))
+	}
+}
+
+// StaleError is returned by Check, if the generated file does not match its inputs.
+type StaleError struct {
+	File     string      // the generated file
+	Reason   StaleReason // why the file is stale
+	Expected string      // the bundle version required by the inputs
+	Found    string      // the bundle version of the generated file, if any
+	Added    []string    // names of resources, which are missing in the generated file
+	Removed  []string    // names of resources, which are only in the generated file
+	Modified []string    // names of resources, whose content differs
+}
+
+func (e *StaleError) Error() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s is %s", e.File, e.Reason)
+	diff := resourceDiff{Added: e.Added, Removed: e.Removed, Modified: e.Modified}
+	switch {
+	case !diff.empty():
+		sb.WriteString(": " + diff.String())
+	case e.Reason == StaleOutdated:
+		sb.WriteString(": options or generator version have changed")
+	}
+
+	return sb.String()
+}
+
+// Check verifies, that the generated file is up to date with the given options, without writing anything.
+// It returns a *StaleError, if the file is missing, out of date or has been edited by hand. This is intended
+// to reject changes in continuous integration, which forgot to run go generate.
+func Check(opts Options) error {
+	return check(opts, nil)
+}
+
+// Check is like the package level Check, for the given named bundles or all declared bundles, if no names
+// are given. It returns the error of the first stale bundle.
+func (c *Config) Check(names ...string) error {
+	bundles, err := c.selectBundles(names)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bundles {
+		if err := check(b.options(), c.raw); err != nil {
+			return fmt.Errorf("bundle '%s': %w", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func check(opts Options, config []byte) error {
+	p, err := newPlan(opts, config)
+	if err != nil {
+		return err
+	}
+
+	expected, err := p.resourceHashes()
+	if err != nil {
+		return err
+	}
+
+	staleErr := &StaleError{
+		File:     p.targetFile,
+		Expected: p.requiredHash,
+	}
+
+	if _, err := os.Stat(p.targetFile); os.IsNotExist(err) {
+		staleErr.Reason = StaleMissing
+		staleErr.Added = diffResources(nil, expected).Added
+		return staleErr
+	}
+
+	gen, err := parseGenFile(p.targetFile)
+	if err != nil {
+		staleErr.Reason = StaleModified
+		return staleErr
+	}
+
+	found := make(map[string]string, len(gen.Resources))
+	for name, r := range gen.Resources {
+		found[name] = r.Sha256
+	}
+
+	diff := diffResources(found, expected)
+	staleErr.Found = gen.Version
+	staleErr.Added = diff.Added
+	staleErr.Removed = diff.Removed
+	staleErr.Modified = diff.Modified
+
+	if gen.Version != p.requiredHash {
+		staleErr.Reason = StaleOutdated
+		return staleErr
+	}
+
+	if !diff.empty() {
+		staleErr.Reason = StaleModified
+		return staleErr
+	}
+
+	for _, r := range gen.Resources {
+		if !gen.verify(r) {
+			staleErr.Reason = StaleModified
+			staleErr.Modified = append(staleErr.Modified, r.Name)
+		}
+	}
+
+	if staleErr.Reason != 0 {
+		sort.Strings(staleErr.Modified)
+		return staleErr
+	}
+
+	return checkManifest(p)
+}
+
+// verify returns true, if the embedded blobs of the resource, including an embedded gzip variant, exist and
+// unpack to the recorded sha256. Blobs of codecs, which are not registered in the generator, are accepted.
+func (g *genFile) verify(r genResource) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false // the blob cannot be decoded or decompressed
+		}
+	}()
+
+	data, found := g.Blobs[r.ConstName]
+	if !found {
+		return false
+	}
+
+	buf := mustDecodeBlob(r.Encoding, data)
+	if r.Codec != EncodingIdentity {
+		codecName := r.Codec
+		if codecName == "" {
+			codecName = DefaultCodec
+		}
+
+		codec, registered := LookupCodec(codecName)
+		if !registered {
+			return true
+		}
+		buf = mustDecompress(codec, buf)
+	}
+
+	if !hasSha256(buf, r.Sha256) {
+		return false
+	}
+
+	if r.GzipConst == "" {
+		return true
+	}
+
+	gzipData, found := g.Blobs[r.GzipConst]
+	if !found {
+		return false
+	}
+
+	return hasSha256(mustDecompress(mustCodec(EncodingGzip), mustDecodeBlob(r.Encoding, gzipData)), r.Sha256)
+}
+
+// hasSha256 compares the digest of buf with the given hex encoded sha256.
+func hasSha256(buf []byte, sha256Hex string) bool {
+	hash := sha256.Sum256(buf)
+	return hex.EncodeToString(hash[:]) == sha256Hex
+}
+
+// checkManifest verifies the configured manifest file of an up to date generated file.
+func checkManifest(p *plan) error {
+	if p.opts.ManifestFile == "" {
+		return nil
+	}
+
+	expected, err := p.expectedManifest()
+	if err != nil {
+		return err
+	}
+
+	staleErr := &StaleError{
+		File:     p.manifestFile(),
+		Expected: p.requiredHash,
+		Found:    p.requiredHash,
+	}
+
+	found, err := ioutil.ReadFile(staleErr.File)
+	switch {
+	case os.IsNotExist(err):
+		staleErr.Reason = StaleMissing
+		return staleErr
+	case err != nil:
+		return err
+	case !bytes.Equal(found, expected):
+		staleErr.Reason = StaleModified
+		return staleErr
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testModule creates a go module with the files web/a.txt and web/b.txt in a temporary directory and changes
+// into it. The returned options embed the web folder into the assets package.
+func testModule(t *testing.T) Options {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := os.Chdir(cwd); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	writeTestFile(t, "go.mod", "module example.com/test\n")
+	writeTestFile(t, "web/a.txt", strings.Repeat("hello a ", 100))
+	writeTestFile(t, "web/b.txt", strings.Repeat("hello b ", 100))
+	if err := os.Mkdir("assets", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	return Options{
+		TargetDir:               "assets",
+		PackageName:             "assets",
+		Include:                 []string{"web"},
+		StripPrefixes:           []string{"/web"},
+		DisableCompressionCache: true,
+		OnEvent:                 func(e Event) {},
+	}
+}
+
+func writeTestFile(t *testing.T, fname, content string) {
+	if err := os.MkdirAll(filepath.Dir(fname), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(fname, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectStale fails, if err is not a *StaleError with the given reason.
+func expectStale(t *testing.T, err error, reason StaleReason) *StaleError {
+	t.Helper()
+	var staleErr *StaleError
+	if !errors.As(err, &staleErr) {
+		t.Fatalf("expected a StaleError but got %v", err)
+	}
+
+	if staleErr.Reason != reason {
+		t.Fatalf("expected %s but got %s", reason, staleErr.Reason)
+	}
+
+	return staleErr
+}
+
+func embedAndCheck(t *testing.T, opts Options) {
+	t.Helper()
+	if err := Embed(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Check(opts); err != nil {
+		t.Fatalf("expected an up to date file but got %v", err)
+	}
+}
+
+func TestCheckMissing(t *testing.T) {
+	opts := testModule(t)
+	staleErr := expectStale(t, Check(opts), StaleMissing)
+	if want := []string{"/a.txt", "/b.txt"}; !reflect.DeepEqual(staleErr.Added, want) {
+		t.Fatalf("expected added %v but got %v", want, staleErr.Added)
+	}
+}
+
+func TestCheckOutdated(t *testing.T) {
+	opts := testModule(t)
+	embedAndCheck(t, opts)
+
+	writeTestFile(t, "web/b.txt", "changed")
+	writeTestFile(t, "web/c.txt", "new")
+	if err := os.Remove("web/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	staleErr := expectStale(t, Check(opts), StaleOutdated)
+	diff := resourceDiff{Added: staleErr.Added, Removed: staleErr.Removed, Modified: staleErr.Modified}
+	want := resourceDiff{Added: []string{"/c.txt"}, Removed: []string{"/a.txt"}, Modified: []string{"/b.txt"}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("expected %v but got %v", want, diff)
+	}
+
+	if staleErr.Found == staleErr.Expected {
+		t.Fatalf("expected different versions but got %s", staleErr.Found)
+	}
+}
+
+func TestCheckModifiedBlob(t *testing.T) {
+	opts := testModule(t)
+	embedAndCheck(t, opts)
+
+	gen, err := parseGenFile(filepath.Join("assets", "bundle.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the blob by a valid one of different content, as a hand edit would do
+	r := gen.Resources["/a.txt"]
+	buf := []byte(strings.Repeat("edited a ", 100))
+	if r.Codec != EncodingIdentity {
+		codecName := r.Codec
+		if codecName == "" {
+			codecName = DefaultCodec
+		}
+		buf = mustCompress(mustCodec(codecName), buf)
+	}
+
+	src, err := ioutil.ReadFile(filepath.Join("assets", "bundle.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldLiteral := blobLiteral(r.Encoding, gen.Blobs[r.ConstName])
+	if !strings.Contains(string(src), oldLiteral) {
+		t.Fatalf("blob literal of %s not found", r.ConstName)
+	}
+
+	edited := strings.Replace(string(src), oldLiteral, blobLiteral(r.Encoding, mustEncodeBlob(r.Encoding, buf)), 1)
+	writeTestFile(t, filepath.Join("assets", "bundle.gen.go"), edited)
+
+	staleErr := expectStale(t, Check(opts), StaleModified)
+	if want := []string{"/a.txt"}; !reflect.DeepEqual(staleErr.Modified, want) {
+		t.Fatalf("expected modified %v but got %v", want, staleErr.Modified)
+	}
+
+	if staleErr.Found != staleErr.Expected {
+		t.Fatalf("expected the unchanged version %s but got %s", staleErr.Expected, staleErr.Found)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	opts := testModule(t)
+	opts.ManifestFile = "manifest.json"
+	embedAndCheck(t, opts)
+
+	if err := os.Remove("manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	staleErr := expectStale(t, Check(opts), StaleMissing)
+	if filepath.Base(staleErr.File) != "manifest.json" {
+		t.Fatalf("expected the manifest file but got %s", staleErr.File)
+	}
+
+	// Embed rewrites the manifest of an up to date file
+	embedAndCheck(t, opts)
+}
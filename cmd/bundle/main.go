@@ -0,0 +1,356 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command bundle embeds files or folders into a generated go source file. It is a thin wrapper around
+// bundle.Embed and is intended to be used from go generate, e.g.
+//
+//	//go:generate go run github.com/golangee/bundle/cmd/bundle -pkg assets -include ./web
+//
+// Alternatively all bundles declared in a configuration file can be generated at once:
+//
+//	//go:generate go run github.com/golangee/bundle/cmd/bundle -config bundle.yaml
+//
+// All relative paths are resolved against the root of the go module, just like bundle.Embed does.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/golangee/bundle"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run parses the arguments and invokes the generator. It returns the process exit code.
+func run(args []string, stderr io.Writer) int {
+	opts := bundle.Options{}
+	var config string
+	var names []string
+	var watch bool
+	var check bool
+	var dryRun bool
+	var format string
+	var report string
+	var interval time.Duration
+	var quiet, verbose bool
+
+	flags := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.TargetDir, "dir", "", "target directory for bundle.gen.go, relative to the module root")
+	flags.StringVar(&opts.PackageName, "pkg", os.Getenv("GOPACKAGE"), "package name of the generated file, defaults to $GOPACKAGE")
+	flags.Var((*stringList)(&opts.Include), "include", "file or folder to embed, relative to the module root (repeatable or comma separated)")
+	flags.Var((*stringList)(&opts.StripPrefixes), "strip", "prefix to remove from resource names (repeatable or comma separated)")
+	flags.StringVar(&opts.Prefix, "prefix", "", "prefix to attach to all resource names")
+	flags.StringVar(&opts.IgnoreRegex, "ignore", "", "regular expression of file names to ignore, e.g. '.*\\.map|^\\..*'")
+	flags.BoolVar(&opts.DisableCacheUnpacked, "no-cache-unpacked", false, "do not cache the unpacked variant in memory")
+	flags.BoolVar(&opts.DisableCacheGzip, "no-cache-gzip", false, "do not cache the gzip variant in memory")
+	flags.BoolVar(&opts.DisableCacheBrotli, "no-cache-brotli", false, "do not cache the brotli variant in memory")
+	flags.BoolVar(&opts.DisableCacheZstd, "no-cache-zstd", false, "do not cache the zstd variant in memory")
+	flags.StringVar(&opts.Codec, "codec", "", "registered codec to store the files with: "+strings.Join(bundle.Codecs(), ", ")+" (default "+bundle.DefaultCodec+")")
+	flags.Var((*compressionRules)(&opts.Compression), "compression", "codec level and optional window for matching files, e.g. '*.json=5' or '/web/*.js=11:24' (repeatable)")
+	flags.BoolVar(&opts.EmbedGzip, "embed-gzip", false, "also embed the gzip variant, so that it is never compressed at runtime")
+	flags.StringVar(&opts.GzipCodec, "gzip-codec", "", "registered codec producing the embedded gzip variant (default gzip)")
+	flags.Var((*stringList)(&opts.StoreExtensions), "store", "extension of files to embed without compression, replaces the default list of compressed formats (repeatable or comma separated)")
+	flags.Float64Var(&opts.StoreRatio, "store-ratio", 0, fmt.Sprintf("embed files without compression, if they compress to more than this fraction of their size, 1 disables (default %g)", bundle.DefaultStoreRatio))
+	flags.StringVar(&opts.BlobEncoding, "blob-encoding", "", "text encoding of the embedded data: ascii85, base64, base122 or raw (default ascii85)")
+	flags.StringVar(&opts.ModTime, "mod-time", "", "replace the modification time of all files: epoch, source-date-epoch or git")
+	flags.BoolVar(&opts.NormalizeModes, "normalize-modes", false, "use 0644 or 0755 instead of the file modes of the checkout")
+	flags.StringVar(&opts.ManifestFile, "manifest", "", "also write a json manifest of the fingerprinted resource names, relative to the module root")
+	flags.StringVar(&config, "config", "", "load the bundle options from a bundle.yaml or bundle.json file instead of flags")
+	flags.Var((*stringList)(&names), "name", "only generate the named bundles of the -config file (repeatable or comma separated)")
+	flags.BoolVar(&watch, "watch", false, "keep running and regenerate whenever an included file changes")
+	flags.BoolVar(&check, "check", false, "do not write anything but fail, if the generated file is missing, out of date or modified")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write anything but report the changes to the generated file")
+	flags.StringVar(&format, "format", "text", "format of the -dry-run report: text or json")
+	flags.StringVar(&report, "report", "-", "file to write the -dry-run report to, - for stdout")
+	flags.DurationVar(&interval, "interval", bundle.DefaultWatchInterval, "polling interval of -watch")
+	flags.IntVar(&opts.Concurrency, "concurrency", 0, "amount of files to compress in parallel, defaults to GOMAXPROCS")
+	flags.StringVar(&opts.CompressionCacheDir, "cache-dir", "", "directory of the compression cache, defaults to the user cache dir")
+	flags.BoolVar(&opts.DisableCompressionCache, "no-cache", false, "do not use the compression cache")
+	flags.BoolVar(&quiet, "q", false, "quiet, only print errors")
+	flags.BoolVar(&verbose, "v", false, "verbose, print every discovered, compressed and deduplicated file")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: bundle [flags]\n\n")
+		fmt.Fprintf(stderr, "Embeds files or folders into a generated bundle.gen.go file.\n\n")
+		fmt.Fprintf(stderr, "Flags:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		return exitUsage
+	}
+
+	if countTrue(watch, check, dryRun) > 1 {
+		fmt.Fprintln(stderr, "-watch, -check and -dry-run are mutually exclusive")
+		return exitUsage
+	}
+
+	if quiet && verbose {
+		fmt.Fprintln(stderr, "-q cannot be combined with -v")
+		return exitUsage
+	}
+
+	switch {
+	case quiet:
+		opts.LogLevel = bundle.LogQuiet
+	case verbose:
+		opts.LogLevel = bundle.LogVerbose
+	}
+
+	if format != "text" && format != "json" {
+		fmt.Fprintf(stderr, "unsupported -format '%s', expected text or json\n", format)
+		return exitUsage
+	}
+
+	if config != "" {
+		var conflicts []string
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "config", "name", "watch", "check", "dry-run", "format", "report", "interval", "q", "v", "concurrency", "cache-dir", "no-cache":
+			default:
+				conflicts = append(conflicts, "-"+f.Name)
+			}
+		})
+
+		if len(conflicts) > 0 {
+			fmt.Fprintf(stderr, "-config cannot be combined with %s\n", strings.Join(conflicts, ", "))
+			return exitUsage
+		}
+
+		cfg, err := bundle.LoadConfig(config)
+		if err != nil {
+			fmt.Fprintf(stderr, "bundle: %v\n", err)
+			return exitError
+		}
+
+		for i := range cfg.Bundles {
+			if quiet || verbose {
+				cfg.Bundles[i].LogLevel = opts.LogLevel
+			}
+
+			if opts.Concurrency > 0 {
+				cfg.Bundles[i].Concurrency = opts.Concurrency
+			}
+
+			if opts.CompressionCacheDir != "" {
+				cfg.Bundles[i].CompressionCacheDir = opts.CompressionCacheDir
+			}
+
+			if opts.DisableCompressionCache {
+				cfg.Bundles[i].DisableCompressionCache = true
+			}
+		}
+
+		switch {
+		case watch:
+			err = withInterrupt(func(ctx context.Context) error {
+				return cfg.Watch(ctx, interval, names...)
+			})
+		case check:
+			err = cfg.Check(names...)
+		case dryRun:
+			var reports []*bundle.Report
+			if reports, err = cfg.DryRun(names...); err == nil {
+				err = writeReports(report, format, reports, true)
+			}
+		default:
+			err = cfg.Embed(names...)
+		}
+
+		if err != nil {
+			fmt.Fprintf(stderr, "bundle: %v\n", err)
+			return exitError
+		}
+
+		return exitOK
+	}
+
+	if len(names) > 0 {
+		fmt.Fprintln(stderr, "-name requires -config")
+		return exitUsage
+	}
+
+	if opts.PackageName == "" {
+		fmt.Fprintln(stderr, "missing package name: use -pkg or run from go generate")
+		flags.Usage()
+		return exitUsage
+	}
+
+	if len(opts.Include) == 0 {
+		fmt.Fprintln(stderr, "nothing to embed: use -include at least once")
+		flags.Usage()
+		return exitUsage
+	}
+
+	var err error
+	switch {
+	case watch:
+		err = withInterrupt(func(ctx context.Context) error {
+			return bundle.Watch(ctx, opts, interval)
+		})
+	case check:
+		err = bundle.Check(opts)
+	case dryRun:
+		var r *bundle.Report
+		if r, err = bundle.DryRun(opts); err == nil {
+			err = writeReports(report, format, []*bundle.Report{r}, false)
+		}
+	default:
+		err = bundle.Embed(opts)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "bundle: %v\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// withInterrupt runs f with a context, which is cancelled on the first interrupt signal.
+func withInterrupt(f func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return f(ctx)
+}
+
+// writeReports writes the given dry-run reports to the named file or to stdout. To keep the output a valid
+// document, the json format encodes an array, if list is true, and otherwise the single report.
+func writeReports(fname, format string, reports []*bundle.Report, list bool) (err error) {
+	var w io.Writer = os.Stdout
+	if fname != "-" {
+		f, err := os.Create(fname)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		w = f
+	}
+
+	if format == "json" && !list {
+		return reports[0].WriteJSON(w)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	for _, r := range reports {
+		if err := r.WriteText(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// stringList is a flag.Value which collects repeated flags and splits comma separated values.
+type stringList []string
+
+func (s *stringList) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
+// compressionRules is a flag.Value which parses repeated pattern=level[:window] flags.
+type compressionRules []bundle.CompressionRule
+
+func (c *compressionRules) String() string {
+	if c == nil {
+		return ""
+	}
+
+	var rules []string
+	for _, r := range *c {
+		rules = append(rules, fmt.Sprintf("%s=%d:%d", r.Pattern, r.Level, r.Window))
+	}
+	return strings.Join(rules, ",")
+}
+
+func (c *compressionRules) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i < 0 {
+		return fmt.Errorf("expected pattern=level[:window]")
+	}
+
+	rule := bundle.CompressionRule{Pattern: value[:i]}
+	settings := strings.SplitN(value[i+1:], ":", 2)
+	if _, err := fmt.Sscan(settings[0], &rule.Level); err != nil {
+		return fmt.Errorf("invalid level: %w", err)
+	}
+
+	if len(settings) == 2 {
+		if _, err := fmt.Sscan(settings[1], &rule.Window); err != nil {
+			return fmt.Errorf("invalid window: %w", err)
+		}
+	}
+
+	*c = append(*c, rule)
+	return nil
+}
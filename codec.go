@@ -0,0 +1,295 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// EncodingZstd is the content coding of Zstandard (RFC 8878).
+const EncodingZstd = "zstd"
+
+// DefaultCodec is the codec, which the generator uses to store resources, if Options.Codec is empty.
+const DefaultCodec = EncodingBrotli
+
+// A Codec implements a content coding. Its name is used as the Content-Encoding token and in the generated
+// code, so it must be stable. Implementations must be safe for concurrent use and Compress must be
+// deterministic, because the generated output must not change for equal input.
+type Codec interface {
+	// Name returns the lower case content coding token, e.g. br, gzip or zstd.
+	Name() string
+	// Compress returns the compressed variant of buf.
+	Compress(buf []byte) ([]byte, error)
+	// Decompress returns the original data of buf.
+	Decompress(buf []byte) ([]byte, error)
+}
+
+// LevelCodec is implemented by codecs, which support different compression levels and window sizes. The
+// generator uses it for Options.Compression.
+type LevelCodec interface {
+	Codec
+	// WithLevel returns a codec with the given codec specific level and base 2 logarithm of the window size.
+	// Zero selects the best level respectively the default window. It fails for unsupported values.
+	WithLevel(level, window int) (Codec, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+}{byName: map[string]Codec{}}
+
+func init() {
+	RegisterCodec(brotliCodec{})
+	RegisterCodec(gzipCodec{})
+	RegisterCodec(&zstdCodec{})
+}
+
+// RegisterCodec makes the codec available to the generator and to handlers. A codec registered with an
+// existing name replaces the previous one. It panics, if the name is empty or identity.
+func RegisterCodec(codec Codec) {
+	name := codec.Name()
+	if name == "" || name == EncodingIdentity {
+		panic(fmt.Sprintf("invalid codec name '%s'", name))
+	}
+
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.byName[name] = codec
+}
+
+// LookupCodec returns the registered codec with the given name.
+func LookupCodec(name string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.byName[name]
+	return codec, ok
+}
+
+// Codecs returns the sorted names of all registered codecs.
+func Codecs() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	var names []string
+	for name := range codecs.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mustCodec returns the registered codec or panics. The empty name denotes the DefaultCodec.
+func mustCodec(name string) Codec {
+	if name == "" {
+		name = DefaultCodec
+	}
+
+	codec, ok := LookupCodec(name)
+	if !ok {
+		panic(fmt.Sprintf("codec '%s' is not registered", name))
+	}
+	return codec
+}
+
+// mustCompress panics, if buf cannot be compressed.
+func mustCompress(codec Codec, buf []byte) []byte {
+	res, err := codec.Compress(buf)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// mustDecompress panics, if buf cannot be decompressed.
+func mustDecompress(codec Codec, buf []byte) []byte {
+	res, err := codec.Decompress(buf)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// brotliCodec compresses with the given brotli quality from 1 to 11 and a window from 10 to 24. Zero selects
+// the best quality respectively an automatic window.
+type brotliCodec struct {
+	quality int
+	lgwin   int
+}
+
+func (brotliCodec) Name() string {
+	return EncodingBrotli
+}
+
+func (c brotliCodec) WithLevel(level, window int) (Codec, error) {
+	if level < 0 || level > brotli.BestCompression {
+		return nil, fmt.Errorf("brotli quality must be between 1 and %d", brotli.BestCompression)
+	}
+
+	if window != 0 && (window < 10 || window > 24) {
+		return nil, fmt.Errorf("brotli window must be between 10 and 24")
+	}
+
+	return brotliCodec{quality: level, lgwin: window}, nil
+}
+
+func (c brotliCodec) Compress(buf []byte) ([]byte, error) {
+	quality := c.quality
+	if quality == 0 {
+		quality = brotli.BestCompression
+	}
+
+	tmp := &bytes.Buffer{}
+	writer := brotli.NewWriterOptions(tmp, brotli.WriterOptions{Quality: quality, LGWin: c.lgwin})
+	if _, err := writer.Write(buf); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return tmp.Bytes(), nil
+}
+
+func (brotliCodec) Decompress(buf []byte) ([]byte, error) {
+	return ioutil.ReadAll(brotli.NewReader(bytes.NewReader(buf)))
+}
+
+// gzipCodec compresses with the given gzip level from 1 to 9. Zero selects the best level. The window is
+// fixed by deflate.
+type gzipCodec struct {
+	level int
+}
+
+func (gzipCodec) Name() string {
+	return EncodingGzip
+}
+
+func (c gzipCodec) WithLevel(level, window int) (Codec, error) {
+	if level < 0 || level > gzip.BestCompression {
+		return nil, fmt.Errorf("gzip level must be between 1 and %d", gzip.BestCompression)
+	}
+
+	if window != 0 && window != 15 {
+		return nil, fmt.Errorf("gzip window is always 15")
+	}
+
+	return gzipCodec{level: level}, nil
+}
+
+func (c gzipCodec) Compress(buf []byte) ([]byte, error) {
+	level := c.level
+	if level == 0 {
+		level = gzip.BestCompression
+	}
+
+	tmp := &bytes.Buffer{}
+	writer, err := gzip.NewWriterLevel(tmp, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(buf); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return tmp.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(buf []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// zstdCodec compresses with the given Zstandard level from 1 to 22 and a window from 10 to 27. Zero selects
+// the best level respectively the default window. Note, that browsers only accept windows up to 23. The encoder
+// and decoder are expensive to create, but safe for concurrent use, so they are shared.
+type zstdCodec struct {
+	level   int
+	window  int
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (c *zstdCodec) Name() string {
+	return EncodingZstd
+}
+
+func (c *zstdCodec) WithLevel(level, window int) (Codec, error) {
+	if level < 0 || level > 22 {
+		return nil, fmt.Errorf("zstd level must be between 1 and 22")
+	}
+
+	if window != 0 && (window < 10 || window > 27) {
+		return nil, fmt.Errorf("zstd window must be between 10 and 27")
+	}
+
+	return &zstdCodec{level: level, window: window}, nil
+}
+
+func (c *zstdCodec) init() error {
+	c.once.Do(func() {
+		level := zstd.SpeedBestCompression
+		if c.level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.level)
+		}
+
+		opts := []zstd.EOption{zstd.WithEncoderLevel(level)}
+		if c.window != 0 {
+			opts = append(opts, zstd.WithWindowSize(1<<c.window))
+		}
+
+		c.encoder, c.err = zstd.NewWriter(nil, opts...)
+		if c.err != nil {
+			return
+		}
+
+		c.decoder, c.err = zstd.NewReader(nil)
+	})
+
+	return c.err
+}
+
+func (c *zstdCodec) Compress(buf []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.encoder.EncodeAll(buf, nil), nil
+}
+
+func (c *zstdCodec) Decompress(buf []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.decoder.DecodeAll(buf, nil)
+}
@@ -19,51 +19,9 @@ import (
 	"compress/gzip"
 	"encoding/ascii85"
 	"encoding/base64"
-	"github.com/andybalholm/brotli"
 	"io/ioutil"
 )
 
-func mustGzipCompress(in []byte) []byte {
-	buf := &bytes.Buffer{}
-	writer, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
-	if err != nil {
-		panic(err)
-	}
-	_, err = writer.Write(in)
-	if err != nil {
-		panic(err)
-	}
-	err = writer.Close()
-	if err != nil {
-		panic(err)
-	}
-	return buf.Bytes()
-}
-
-func mustBrotliCompress(in []byte) []byte {
-	buf := &bytes.Buffer{}
-	writer := brotli.NewWriterLevel(buf, brotli.BestCompression)
-	_, err := writer.Write(in)
-	if err != nil {
-		panic(err)
-	}
-	err = writer.Close()
-	if err != nil {
-		panic(err)
-	}
-	return buf.Bytes()
-}
-
-func mustBrotliDecompress(in []byte) []byte {
-	buf := bytes.NewBuffer(in)
-	reader := brotli.NewReader(buf)
-	b, err := ioutil.ReadAll(reader)
-	if err != nil {
-		panic(err)
-	}
-	return b
-}
-
 // mustDecodeBase64 panics, if str cannot be decoded
 func mustDecodeBase64(str string) []byte {
 	b, err := base64.StdEncoding.DecodeString(str)
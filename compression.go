@@ -0,0 +1,95 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CompressionRule configures the storage codec for all files matching the glob pattern, e.g. a fast level
+// for huge json dumps:
+//
+//	compression:
+//	  - pattern: '*.json'
+//	    level: 5
+//	  - pattern: /web/*.js
+//	    level: 11
+//	    window: 24
+//
+// Like WithCacheRule, a pattern containing a slash is matched against the entire resource name, otherwise only
+// against the base name. The first matching rule wins. Levels and windows are codec specific, see LevelCodec.
+// Files with equal content share the settings of the first of them.
+type CompressionRule struct {
+	Pattern string `yaml:"pattern"`
+	Level   int    `yaml:"level" json:",omitempty"`  // codec specific level, 0 selects the best level
+	Window  int    `yaml:"window" json:",omitempty"` // base 2 logarithm of the window size, 0 selects the default
+}
+
+// ruleCodec is a storage codec configured by a CompressionRule.
+type ruleCodec struct {
+	rule     CompressionRule
+	codec    Codec
+	settings string
+}
+
+// resolveCompression validates the rules and configures the codec for each of them.
+func resolveCompression(codec Codec, rules []CompressionRule, encoding string) ([]ruleCodec, error) {
+	var res []ruleCodec
+	for i, rule := range rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			return nil, fmt.Errorf("compression rule #%d: invalid pattern '%s'", i, rule.Pattern)
+		}
+
+		levelCodec, ok := codec.(LevelCodec)
+		if !ok {
+			return nil, fmt.Errorf("compression rule #%d: codec '%s' does not support levels", i, codec.Name())
+		}
+
+		configured, err := levelCodec.WithLevel(rule.Level, rule.Window)
+		if err != nil {
+			return nil, fmt.Errorf("compression rule #%d: %w", i, err)
+		}
+
+		res = append(res, ruleCodec{
+			rule:     rule,
+			codec:    configured,
+			settings: blobSettings(codec, rule.Level, rule.Window, encoding),
+		})
+	}
+
+	return res, nil
+}
+
+// codecFor returns the storage codec and its cache settings for the named resource.
+func (p *plan) codecFor(name string) (Codec, string) {
+	for _, r := range p.rules {
+		if matchGlob(r.rule.Pattern, name) {
+			return r.codec, r.settings
+		}
+	}
+
+	return p.codec, blobSettings(p.codec, 0, 0, p.encoding)
+}
+
+// matchGlob matches a pattern containing a slash against the entire name, otherwise only against the base name.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
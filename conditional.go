@@ -0,0 +1,136 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isZeroTime reports whether t carries no usable modification date.
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
+
+// scanETag returns the first entity tag of a comma separated list like `W/"a", "b"` and the remaining list.
+// The tag is empty, if the list is malformed.
+func scanETag(s string) (etag string, remain string) {
+	s = strings.TrimLeft(s, " \t")
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+
+	if len(s[start:]) < 2 || s[start] != '"' {
+		return "", ""
+	}
+
+	// etagc is %x21 / %x23-7E / obs-text, so the first quote after the opening one terminates the tag
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		case c == 0x21 || (c >= 0x23 && c != 0x7f):
+		default:
+			return "", ""
+		}
+	}
+
+	return "", ""
+}
+
+// etagStrongMatch compares two entity tags strongly, so both must not be weak and must be equal.
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && a[0] == '"'
+}
+
+// etagWeakMatch compares two entity tags ignoring the weakness indicator.
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// etagListMatches evaluates a list like If-Match or If-None-Match against the current entity tag, using the
+// given comparison function. The wildcard * matches any current representation.
+func etagListMatches(list string, etag string, match func(a, b string) bool) bool {
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return false
+		}
+
+		if list[0] == '*' {
+			return true
+		}
+
+		tag, remain := scanETag(list)
+		if tag == "" {
+			return false
+		}
+
+		if match(tag, etag) {
+			return true
+		}
+		list = remain
+	}
+}
+
+// checkPreconditions evaluates the conditional request headers in the order given by RFC 9110 section 13.2.2 and
+// answers the request with 304 or 412, if required. It returns true, if the request has been answered.
+func checkPreconditions(writer http.ResponseWriter, request *http.Request, etag string, lastMod time.Time) bool {
+	lastMod = lastMod.Truncate(time.Second)
+	hasLastMod := !isZeroTime(lastMod)
+	isGetOrHead := request.Method == http.MethodGet || request.Method == http.MethodHead
+
+	if ifMatch := request.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, etagStrongMatch) {
+			writer.WriteHeader(http.StatusPreconditionFailed)
+			return true
+		}
+	} else if ifUnmodifiedSince := request.Header.Get("If-Unmodified-Since"); ifUnmodifiedSince != "" && hasLastMod {
+		if date, err := http.ParseTime(ifUnmodifiedSince); err == nil && lastMod.After(date) {
+			writer.WriteHeader(http.StatusPreconditionFailed)
+			return true
+		}
+	}
+
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, etagWeakMatch) {
+			if isGetOrHead {
+				writeNotModified(writer)
+			} else {
+				writer.WriteHeader(http.StatusPreconditionFailed)
+			}
+			return true
+		}
+	} else if ifModifiedSince := request.Header.Get("If-Modified-Since"); ifModifiedSince != "" && isGetOrHead && hasLastMod {
+		if date, err := http.ParseTime(ifModifiedSince); err == nil && !lastMod.After(date) {
+			writeNotModified(writer)
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeNotModified removes the representation specific headers which must not be sent with a 304 response.
+func writeNotModified(writer http.ResponseWriter) {
+	h := writer.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	writer.WriteHeader(http.StatusNotModified)
+}
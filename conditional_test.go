@@ -0,0 +1,171 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScanETag(t *testing.T) {
+	tests := []struct {
+		list   string
+		etag   string
+		remain string
+	}{
+		{`"a"`, `"a"`, ``},
+		{` W/"a", "b"`, `W/"a"`, `, "b"`},
+		{`"a,b", "c"`, `"a,b"`, `, "c"`},
+		{`""`, `""`, ``},
+		{`"a`, ``, ``},
+		{`a`, ``, ``},
+		{`W/a`, ``, ``},
+		{`w/"a"`, ``, ``},
+		{`"a b"`, ``, ``},
+		{`*`, ``, ``},
+	}
+
+	for _, tt := range tests {
+		etag, remain := scanETag(tt.list)
+		if etag != tt.etag || remain != tt.remain {
+			t.Errorf("scanETag(%q): expected %q, %q but got %q, %q", tt.list, tt.etag, tt.remain, etag, remain)
+		}
+	}
+}
+
+func TestETagListMatches(t *testing.T) {
+	tests := []struct {
+		list   string
+		etag   string
+		strong bool
+		weak   bool
+	}{
+		{`"a"`, `"a"`, true, true},
+		{`"b", "a"`, `"a"`, true, true},
+		{`"b" ,, "a"`, `"a"`, true, true},
+		{`"b"`, `"a"`, false, false},
+		{`W/"a"`, `"a"`, false, true},
+		{`"a"`, `W/"a"`, false, true},
+		{`W/"a"`, `W/"a"`, false, true},
+		{`*`, `"a"`, true, true},
+		{`"b", *`, `"a"`, true, true},
+		{`garbage, "a"`, `"a"`, false, false},
+		{``, `"a"`, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagListMatches(tt.list, tt.etag, etagStrongMatch); got != tt.strong {
+			t.Errorf("strong %q against %q: expected %v but got %v", tt.list, tt.etag, tt.strong, got)
+		}
+
+		if got := etagListMatches(tt.list, tt.etag, etagWeakMatch); got != tt.weak {
+			t.Errorf("weak %q against %q: expected %v but got %v", tt.list, tt.etag, tt.weak, got)
+		}
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	const etag = `"abc-br"`
+	lastMod := time.Date(2020, 5, 17, 10, 30, 0, 500, time.UTC) // sub second precision is not transferred
+	before := lastMod.Add(-time.Hour).Format(http.TimeFormat)
+	exact := lastMod.Format(http.TimeFormat)
+	after := lastMod.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		method  string
+		header  []string
+		lastMod time.Time
+		status  int // 0, if the request has not been answered
+	}{
+		{name: "unconditional", status: 0},
+		{name: "if-match", header: []string{"If-Match", etag}, status: 0},
+		{name: "if-match list", header: []string{"If-Match", `"x", ` + etag}, status: 0},
+		{name: "if-match star", header: []string{"If-Match", "*"}, status: 0},
+		{name: "if-match other", header: []string{"If-Match", `"x", "y"`}, status: 412},
+		{name: "if-match weak", header: []string{"If-Match", "W/" + etag}, status: 412},
+		{name: "if-none-match", header: []string{"If-None-Match", etag}, status: 304},
+		{name: "if-none-match head", method: http.MethodHead, header: []string{"If-None-Match", etag}, status: 304},
+		{name: "if-none-match list", header: []string{"If-None-Match", `"x", ` + etag}, status: 304},
+		{name: "if-none-match weak", header: []string{"If-None-Match", "W/" + etag}, status: 304},
+		{name: "if-none-match star", header: []string{"If-None-Match", "*"}, status: 304},
+		{name: "if-none-match other", header: []string{"If-None-Match", `"x"`}, status: 0},
+		{name: "if-none-match post", method: http.MethodPost, header: []string{"If-None-Match", etag}, status: 412},
+		{name: "if-none-match star put", method: http.MethodPut, header: []string{"If-None-Match", "*"}, status: 412},
+		{name: "if-unmodified-since", header: []string{"If-Unmodified-Since", exact}, status: 0},
+		{name: "if-unmodified-since after", header: []string{"If-Unmodified-Since", after}, status: 0},
+		{name: "if-unmodified-since before", header: []string{"If-Unmodified-Since", before}, status: 412},
+		{name: "if-unmodified-since invalid", header: []string{"If-Unmodified-Since", "yesterday"}, status: 0},
+		{name: "if-unmodified-since without date", header: []string{"If-Unmodified-Since", before}, lastMod: time.Unix(0, 0), status: 0},
+		{name: "if-match wins over if-unmodified-since", header: []string{"If-Match", etag, "If-Unmodified-Since", before}, status: 0},
+		{name: "if-modified-since", header: []string{"If-Modified-Since", exact}, status: 304},
+		{name: "if-modified-since after", header: []string{"If-Modified-Since", after}, status: 304},
+		{name: "if-modified-since before", header: []string{"If-Modified-Since", before}, status: 0},
+		{name: "if-modified-since invalid", header: []string{"If-Modified-Since", "yesterday"}, status: 0},
+		{name: "if-modified-since post", method: http.MethodPost, header: []string{"If-Modified-Since", exact}, status: 0},
+		{name: "if-modified-since without date", header: []string{"If-Modified-Since", exact}, lastMod: time.Unix(0, 0), status: 0},
+		{name: "if-none-match wins over if-modified-since", header: []string{"If-None-Match", `"x"`, "If-Modified-Since", exact}, status: 0},
+		{name: "if-match before if-none-match", header: []string{"If-Match", `"x"`, "If-None-Match", etag}, status: 412},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			mod := tt.lastMod
+			if mod.IsZero() {
+				mod = lastMod
+			}
+
+			req := httptest.NewRequest(method, "/a.txt", nil)
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				req.Header.Set(tt.header[i], tt.header[i+1])
+			}
+
+			rec := httptest.NewRecorder()
+			rec.Header().Set("Content-Type", "text/plain")
+			answered := checkPreconditions(rec, req, etag, mod)
+			if answered != (tt.status != 0) {
+				t.Fatalf("expected answered %v but got %v", tt.status != 0, answered)
+			}
+
+			if answered && rec.Code != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, rec.Code)
+			}
+
+			if tt.status == http.StatusNotModified && rec.Header().Get("Content-Type") != "" {
+				t.Errorf("304 must not contain a Content-Type")
+			}
+		})
+	}
+}
+
+func TestHandlerNotModified(t *testing.T) {
+	h, res := testHandler("hello")
+	rec := serve(h, http.MethodGet, "/a.txt", "If-None-Match", res.etag(EncodingIdentity))
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 304 but got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(h, http.MethodGet, "/a.txt", "If-Modified-Since", testLastMod.Format(http.TimeFormat))
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 but got %d", rec.Code)
+	}
+}
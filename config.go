@@ -0,0 +1,167 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigVersion is the only supported version of the configuration file format.
+const ConfigVersion = 1
+
+// Config describes the content of a bundle.yaml or bundle.json file. A single file may declare multiple
+// named bundles, each with its own target dir, package name and include set, e.g.
+//
+//	version: 1
+//	bundles:
+//	  - name: web
+//	    targetDir: internal/assets
+//	    packageName: assets
+//	    include: [web/dist]
+//	    ignoreRegex: '.*\.map'
+//
+// All paths are resolved relative to the root of the go module, just like Options.
+type Config struct {
+	Version int            `json:"version" yaml:"version"`
+	Bundles []BundleConfig `json:"bundles" yaml:"bundles"`
+
+	raw []byte // the unparsed file content, folded into the bundle hash
+}
+
+// BundleConfig declares the options of a single named bundle within a Config.
+type BundleConfig struct {
+	Name    string `json:"name" yaml:"name"`
+	Options `yaml:",inline"`
+}
+
+// LoadConfig reads and validates the given configuration file. Files ending with .json are parsed as json,
+// everything else as yaml.
+func LoadConfig(fname string) (*Config, error) {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{raw: buf}
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		dec := yaml.NewDecoder(bytes.NewReader(buf))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.Version != ConfigVersion {
+		return fmt.Errorf("unsupported config version %d, expected %d", c.Version, ConfigVersion)
+	}
+
+	if len(c.Bundles) == 0 {
+		return fmt.Errorf("no bundles declared")
+	}
+
+	names := map[string]bool{}
+	for i, b := range c.Bundles {
+		if b.Name == "" {
+			return fmt.Errorf("bundle #%d has no name", i)
+		}
+
+		if names[b.Name] {
+			return fmt.Errorf("bundle '%s' is declared multiple times", b.Name)
+		}
+		names[b.Name] = true
+
+		if b.PackageName == "" {
+			return fmt.Errorf("bundle '%s' has no packageName", b.Name)
+		}
+	}
+
+	return nil
+}
+
+// Find returns the named bundle configuration or nil.
+func (c *Config) Find(name string) *BundleConfig {
+	for i := range c.Bundles {
+		if c.Bundles[i].Name == name {
+			return &c.Bundles[i]
+		}
+	}
+	return nil
+}
+
+// selectBundles returns the given named bundles or all declared bundles, if no names are given.
+func (c *Config) selectBundles(names []string) ([]BundleConfig, error) {
+	if len(names) == 0 {
+		return c.Bundles, nil
+	}
+
+	var bundles []BundleConfig
+	for _, name := range names {
+		b := c.Find(name)
+		if b == nil {
+			return nil, fmt.Errorf("bundle '%s' is not declared", name)
+		}
+		bundles = append(bundles, *b)
+	}
+
+	return bundles, nil
+}
+
+// Embed generates the given named bundles or all declared bundles, if no names are given.
+func (c *Config) Embed(names ...string) error {
+	bundles, err := c.selectBundles(names)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bundles {
+		if err := embed(b.options(), c.raw); err != nil {
+			return fmt.Errorf("bundle '%s': %w", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// EmbedConfig loads the given configuration file and generates the given named bundles or all declared bundles,
+// if no names are given.
+func EmbedConfig(fname string, names ...string) error {
+	cfg, err := LoadConfig(fname)
+	if err != nil {
+		return err
+	}
+	return cfg.Embed(names...)
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DevEnv is the name of the environment variable, which enables the development mode for all bundles created by
+// Make. Its value is either the root of the go module, which contains the original files, or 1 or true to
+// pick the module root of the working directory.
+const DevEnv = "BUNDLE_DEV"
+
+// devPollInterval is the interval, in which the live reload endpoint checks the original files for changes.
+const devPollInterval = 500 * time.Millisecond
+
+// devModeFromEnv returns the development mode configured by DevEnv or nil.
+func devModeFromEnv() *devMode {
+	root := os.Getenv(DevEnv)
+	switch strings.ToLower(root) {
+	case "", "0", "false":
+		return nil
+	case "1", "true":
+		cwd, err := modRoot()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bundle: %s is set, but %v\n", DevEnv, err)
+			return nil
+		}
+		root = cwd
+	}
+
+	return &devMode{root: root, entries: map[string]*devEntry{}}
+}
+
+// Dev returns a new bundle instance in development mode, which transparently reads the original files from disk,
+// using the source paths recorded by the generator relative to the given module root. Changed files get new
+// hashes and etags and resources without a source path or whose file has gone are served as embedded.
+// The current bundle is unchanged.
+func (b *Bundle) Dev(root string) *Bundle {
+	return &Bundle{
+		resources: b.resources,
+		dev:       &devMode{root: root, entries: map[string]*devEntry{}},
+	}
+}
+
+// refresh returns the current variant of the given resource, which is only different in development mode.
+func (b *Bundle) refresh(r *Resource) *Resource {
+	if b.dev == nil || r == nil {
+		return r
+	}
+	return b.dev.refresh(r)
+}
+
+type devEntry struct {
+	modTime time.Time
+	size    int64
+	res     *Resource
+}
+
+type devMode struct {
+	root    string
+	mutex   sync.Mutex
+	entries map[string]*devEntry // by source path
+}
+
+// refresh returns a resource, which reflects the current state of the original file.
+func (d *devMode) refresh(r *Resource) *Resource {
+	if r.source == "" {
+		return r
+	}
+
+	fname := filepath.Join(d.root, filepath.FromSlash(r.source))
+	stat, err := os.Stat(fname)
+	if err != nil {
+		return r
+	}
+
+	d.mutex.Lock()
+	entry := d.entries[r.source]
+	d.mutex.Unlock()
+
+	if entry != nil && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+		return entry.res
+	}
+
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return r
+	}
+
+	res := NewResourceFromBytes(r.name, buf)
+	res.mode = stat.Mode()
+	res.lastMod = stat.ModTime()
+	res.source = r.source
+
+	d.mutex.Lock()
+	d.entries[r.source] = &devEntry{modTime: stat.ModTime(), size: stat.Size(), res: res}
+	d.mutex.Unlock()
+
+	return res
+}
+
+// snapshot returns a value, which changes whenever one of the original files is modified or removed.
+func (d *devMode) snapshot(resources []*Resource) string {
+	sb := &strings.Builder{}
+	for _, r := range resources {
+		if r.source == "" {
+			continue
+		}
+
+		stat, err := os.Stat(filepath.Join(d.root, filepath.FromSlash(r.source)))
+		if err != nil {
+			fmt.Fprintf(sb, "%s:gone;", r.source)
+			continue
+		}
+		fmt.Fprintf(sb, "%s:%d:%d;", r.source, stat.ModTime().UnixNano(), stat.Size())
+	}
+	return sb.String()
+}
+
+// WithLiveReload serves a server-sent events endpoint at the given path, relative to the handler prefix,
+// which emits a reload event whenever one of the original files changes. A script subscribing to it is
+// injected into all html resources. It only has an effect in development mode, so it is safe to keep it
+// in production code.
+func WithLiveReload(path string) HandlerOption {
+	return func(h *handler) {
+		h.liveReload = path
+	}
+}
+
+// serveLiveReload keeps the connection open and sends a reload event, as soon as a file has changed.
+func (h *handler) serveLiveReload(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	initial := h.dev.snapshot(h.resources)
+	ticker := time.NewTicker(devPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-ticker.C:
+			if h.dev.snapshot(h.resources) != initial {
+				fmt.Fprint(writer, "event: reload\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+		}
+	}
+}
+
+// injectLiveReload returns a copy of the html resource with a script, which reloads the page on a change.
+func (h *handler) injectLiveReload(resource *Resource) *Resource {
+	script := fmt.Sprintf(`<script>new EventSource(%q).addEventListener("reload",function(){location.reload()})</script>`,
+		strings.TrimSuffix(h.prefix, "/")+h.liveReload)
+
+	buf := resource.unpack()
+	idx := bytes.LastIndex(bytes.ToLower(buf), []byte("</body>"))
+	if idx < 0 {
+		idx = len(buf)
+	}
+
+	tmp := make([]byte, 0, len(buf)+len(script))
+	tmp = append(tmp, buf[:idx]...)
+	tmp = append(tmp, script...)
+	tmp = append(tmp, buf[idx:]...)
+
+	res := NewResourceFromBytes(resource.name, tmp)
+	res.lastMod = resource.lastMod
+	return res
+}
@@ -16,12 +16,15 @@ package bundle
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -41,50 +44,236 @@ func (s *srcFile) Blobs() []*blob {
 	return s.blobs
 }
 
-func (s *srcFile) addFile(fname string, name string, opts Options) error {
-	fmt.Println(fname)
+// fileInput is a read and hashed file, which has not been added to a srcFile yet.
+type fileInput struct {
+	fname   string
+	name    string // resource name
+	source  string // slash separated path relative to the module root
+	buf     []byte // the file content, released after compression
+	stat    os.FileInfo
+	mode    os.FileMode
+	modTime time.Time
+	hash    [32]byte
+	hash384 [48]byte
+	hash512 [64]byte
+}
+
+func readFile(fname string, name string, source string) (*fileInput, error) {
 	buf, err := ioutil.ReadFile(fname)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	stat, err := os.Stat(fname)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return &fileInput{
+		fname:   fname,
+		name:    name,
+		source:  source,
+		buf:     buf,
+		stat:    stat,
+		mode:    stat.Mode(),
+		modTime: stat.ModTime(),
+		hash:    sha256.Sum256(buf),
+		hash384: sha512.Sum384(buf),
+		hash512: sha512.Sum512(buf),
+	}, nil
+}
+
+// addFiles adds the given files in order. Each distinct content is compressed by the codec of the plan, which
+// may be configured by a CompressionRule, only once, using up to
+// opts.concurrency() goroutines, or taken from the compression cache. Already compressed formats and files
+// which do not compress well are stored instead. EventCompressed, EventCached and EventStored are emitted as
+// soon as a blob is done, therefore in an undefined order but never concurrently. If the plan has a gzipCodec,
+// the gzip variant of each compressed file is embedded as well.
+func (s *srcFile) addFiles(files []*fileInput, p *plan) error {
+	opts := p.opts
+	// content shared by an already compressed format and any other file is still compressed
+	compress := map[[32]byte]bool{}
+	for _, in := range files {
+		if !opts.storeExtension(in.name) {
+			compress[in.hash] = true
+		}
 	}
 
-	hash := sha256.Sum256(buf)
-	packed := mustEncodeAscii85(mustBrotliCompress(buf))
+	var pending []*fileInput
+	var blobs []*blob
+	for _, in := range files {
+		if s.getBlob(in.hash) == nil {
+			blb := &blob{Hash: in.hash}
+			s.blobs = append(s.blobs, blb)
+			blobs = append(blobs, blb)
+			pending = append(pending, in)
+		}
+	}
+
+	cache := newBlobCache(opts)
+	var cacheErr error
+	var mutex sync.Mutex
+	err := forEach(len(pending), opts.concurrency(), func(i int) error {
+		in, blb := pending[i], blobs[i]
+		event := Event{Kind: EventStored, File: in.fname, Name: in.name, Size: in.stat.Size()}
+		var res, gzipRes compressResult
+		store := !compress[in.hash]
+		if !store {
+			var err error
+			codec, settings := p.codecFor(in.name)
+			if res, err = compressBlob(in, codec, settings, p.encoding, cache); err != nil {
+				return err
+			}
+
+			store = !opts.keepCompressed(in.stat.Size(), res.size)
+			event.Kind = EventCompressed
+			if res.cached {
+				event.Kind = EventCached
+			}
+		}
+
+		if store {
+			res = compressResult{data: mustEncodeBlob(p.encoding, in.buf), size: int64(len(in.buf)), cacheErr: res.cacheErr}
+			blb.Codec = EncodingIdentity
+			event.Kind = EventStored
+		} else if p.gzipCodec != nil {
+			var err error
+			settings := blobSettings(p.gzipCodec, 0, 0, p.encoding)
+			if gzipRes, err = compressBlob(in, p.gzipCodec, settings, p.encoding, cache); err != nil {
+				return err
+			}
+
+			if !isGzip(mustDecodeBlob(p.encoding, gzipRes.data)) {
+				return fmt.Errorf("codec '%s' does not produce gzip streams", p.gzipCodec.Name())
+			}
+			blb.Gzip = blobLiteral(p.encoding, gzipRes.data)
+		}
+
+		blb.Data = blobLiteral(p.encoding, res.data)
+		blb.Compressed = res.size
+		event.CompressedSize = res.size
 
-	blb := s.getBlob(hash)
-	if blb == nil {
-		blb = &blob{
-			Hash: hash,
-			Data: strconv.Quote(packed),
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, err := range []error{res.cacheErr, gzipRes.cacheErr} {
+			if err != nil && cacheErr == nil {
+				cacheErr = err // report only once, the cache is likely not writable at all
+				opts.emit(Event{Kind: EventError, Err: err})
+			}
 		}
-		s.blobs = append(s.blobs, blb)
+		opts.emit(event)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := cache.trim(); err != nil && cacheErr == nil {
+		opts.emit(Event{Kind: EventError, Err: err})
+	}
+
+	first := make(map[*fileInput]bool, len(pending))
+	for _, in := range pending {
+		first[in] = true
+	}
+
+	for _, in := range files {
+		in.buf = nil
+		s.addFile(in, !first[in], p)
+	}
+
+	return nil
+}
+
+// compressResult is the output of a codec, encoded by the blob encoding of the plan.
+type compressResult struct {
+	data     string
+	size     int64 // size of the compressed data
+	cached   bool  // taken from the compression cache
+	cacheErr error // the compressed data could not be put into the cache
+}
+
+// compressBlob compresses and encodes the file or takes the result with the same settings from the cache.
+func compressBlob(in *fileInput, codec Codec, settings string, encoding string, cache *blobCache) (compressResult, error) {
+	if data, size, ok := cache.get(in.hash, settings); ok {
+		return compressResult{data: data, size: size, cached: true}, nil
+	}
+
+	compressed, err := codec.Compress(in.buf)
+	if err != nil {
+		return compressResult{}, fmt.Errorf("%s: %w", in.fname, err)
+	}
+
+	res := compressResult{data: mustEncodeBlob(encoding, compressed), size: int64(len(compressed))}
+	res.cacheErr = cache.put(in.hash, settings, res.data, res.size)
+	return res, nil
+}
+
+// isGzip checks the magic number of the gzip stream.
+func isGzip(buf []byte) bool {
+	return len(buf) >= 2 && buf[0] == 0x1f && buf[1] == 0x8b
+}
+
+// addFile appends the resource of an already compressed file.
+func (s *srcFile) addFile(in *fileInput, deduplicated bool, p *plan) {
+	opts := p.opts
+	blb := s.getBlob(in.hash)
+	if deduplicated {
+		opts.emit(Event{Kind: EventDeduplicated, File: in.fname, Name: in.name, Size: in.stat.Size(), CompressedSize: blb.Compressed})
 	}
 
 	res := &resource{
-		Name:          name,
-		Size:          stat.Size(),
-		Mode:          stat.Mode(),
-		LastMod:       stat.ModTime(),
-		Sha265:        hex.EncodeToString(hash[:]),
+		Name:          in.name,
+		Size:          in.stat.Size(),
+		Mode:          in.mode,
+		LastMod:       in.modTime,
+		Sha265:        hex.EncodeToString(in.hash[:]),
+		Sha384:        base64.StdEncoding.EncodeToString(in.hash384[:]),
+		Sha512:        base64.StdEncoding.EncodeToString(in.hash512[:]),
 		CacheUnpacked: !opts.DisableCacheUnpacked,
 		CacheBrotli:   !opts.DisableCacheBrotli,
 		CacheGzip:     !opts.DisableCacheGzip,
 		ConstName:     blb.ConstName(),
+		Source:        in.source,
+		Compressed:    blb.Compressed,
+	}
+
+	switch {
+	case blb.Codec != "":
+		res.Codec = blb.Codec
+	case p.codec.Name() != DefaultCodec:
+		res.Codec = p.codec.Name()
+	}
+
+	if p.encoding != BlobAscii85 {
+		res.Encoding = p.encoding
+	}
+
+	if blb.Gzip != "" {
+		res.GzipConstName = blb.GzipConstName()
+	}
+
+	if opts.DisableCacheZstd {
+		res.DisableCache = append(res.DisableCache, EncodingZstd)
 	}
 
 	s.Names = append(s.Names, keyValue{
-		Key:   slashToCamelCase(name),
-		Value: name,
+		Key:   slashToCamelCase(in.name),
+		Value: in.name,
 	})
 
 	s.Resources = append(s.Resources, res)
+}
 
-	return nil
+// manifest returns the fingerprinted names of all resources.
+func (s *srcFile) manifest() map[string]string {
+	manifest := make(map[string]string, len(s.Resources))
+	for _, res := range s.Resources {
+		addManifestEntry(manifest, res.Name, res.Sha265)
+	}
+
+	return manifest
 }
 
 func (s *srcFile) getBlob(hash [32]byte) *blob {
@@ -98,14 +287,21 @@ func (s *srcFile) getBlob(hash [32]byte) *blob {
 }
 
 type blob struct {
-	Hash [32]byte
-	Data string
+	Hash       [32]byte
+	Data       string
+	Gzip       string // optional quoted gzip variant
+	Codec      string // EncodingIdentity for stored data, otherwise empty for the codec of the plan
+	Compressed int64  // size of the compressed stream
 }
 
 func (b *blob) ConstName() string {
 	return "blob_" + hex.EncodeToString(b.Hash[:])
 }
 
+func (b *blob) GzipConstName() string {
+	return "gzip_" + hex.EncodeToString(b.Hash[:])
+}
+
 // name string, size int64, mode os.FileMode, lastMod time.Time, sha256 string, cacheUnpacked, cacheBrotli, cacheGzip bool, data string
 type resource struct {
 	Name          string
@@ -113,10 +309,18 @@ type resource struct {
 	Mode          os.FileMode
 	LastMod       time.Time
 	Sha265        string
+	Sha384        string
+	Sha512        string
 	CacheUnpacked bool
 	CacheBrotli   bool
 	CacheGzip     bool
 	ConstName     string
+	Source        string
+	Codec         string   // storage codec, empty for the DefaultCodec
+	Encoding      string   // blob encoding, empty for ascii85
+	GzipConstName string   // name of the embedded gzip variant, if any
+	DisableCache  []string // content codings not covered by the Cache flags
+	Compressed    int64    // size of the compressed variant, not part of the generated code
 }
 
 func (r *resource) FactoryMethod() string {
@@ -136,5 +340,30 @@ func (r *resource) FactoryMethod() string {
 	sb.WriteString(strconv.FormatBool(r.CacheGzip) + ",")
 	sb.WriteString(r.ConstName)
 	sb.WriteString(")")
+
+	sb.WriteString(".WithMeta(bundle.Meta{")
+	sb.WriteString("Sha384:" + strconv.Quote(r.Sha384) + ",")
+	sb.WriteString("Sha512:" + strconv.Quote(r.Sha512) + ",")
+	sb.WriteString("Source:" + strconv.Quote(r.Source) + ",")
+	if r.Codec != "" {
+		sb.WriteString("Codec:" + strconv.Quote(r.Codec) + ",")
+	}
+
+	if r.Encoding != "" {
+		sb.WriteString("Encoding:" + strconv.Quote(r.Encoding) + ",")
+	}
+
+	if r.GzipConstName != "" {
+		sb.WriteString("Gzip:" + r.GzipConstName + ",")
+	}
+
+	if len(r.DisableCache) > 0 {
+		sb.WriteString("DisableCache:[]string{")
+		for _, coding := range r.DisableCache {
+			sb.WriteString(strconv.Quote(coding) + ",")
+		}
+		sb.WriteString("},")
+	}
+	sb.WriteString("})")
 	return sb.String()
 }
@@ -0,0 +1,139 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The content codings which can be served by a handler.
+const (
+	EncodingBrotli   = "br"
+	EncodingGzip     = "gzip"
+	EncodingIdentity = "identity"
+)
+
+// defaultEncodings is the server preference, used if the client rates multiple codings equally.
+var defaultEncodings = []string{EncodingBrotli, EncodingGzip, EncodingIdentity}
+
+// identityOnly is offered for resources, which are stored without compression.
+var identityOnly = []string{EncodingIdentity}
+
+// parseAcceptEncoding parses an Accept-Encoding header value (RFC 9110 section 12.5.3) into a map of lower case
+// codings and their quality values between 0 and 1000. Members with an invalid quality value are dropped.
+func parseAcceptEncoding(header string) map[string]int {
+	res := map[string]int{}
+	for _, member := range strings.Split(header, ",") {
+		params := strings.Split(member, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1000
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) < 2 || (param[0] != 'q' && param[0] != 'Q') || param[1] != '=' {
+				continue
+			}
+
+			var ok bool
+			q, ok = parseQValue(param[2:])
+			if !ok {
+				q = -1
+			}
+		}
+
+		if q < 0 {
+			continue
+		}
+
+		// the same coding given multiple times is a client error, the first one wins
+		if _, ok := res[coding]; !ok {
+			res[coding] = q
+		}
+	}
+
+	return res
+}
+
+// parseQValue parses a weight like 0.5 or 1.000 into an integer between 0 and 1000.
+func parseQValue(str string) (int, bool) {
+	if len(str) == 0 || len(str) > 5 || (str[0] != '0' && str[0] != '1') {
+		return 0, false
+	}
+
+	if len(str) > 1 && str[1] != '.' {
+		return 0, false
+	}
+
+	digits := ""
+	if len(str) > 2 {
+		digits = str[2:]
+	}
+
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+
+	for len(digits) < 3 {
+		digits += "0"
+	}
+
+	frac, _ := strconv.Atoi(digits)
+	q := int(str[0]-'0')*1000 + frac
+	if q > 1000 {
+		return 0, false
+	}
+
+	return q, true
+}
+
+// negotiateEncoding selects the acceptable coding from offered with the highest quality value. Ties are resolved
+// by the order of offered, which is the preference of the server. A missing header (present is false) or an
+// empty one only accepts identity. Identity is acceptable unless excluded explicitly or by "*;q=0".
+// It returns false, if none of the offered codings is acceptable.
+func negotiateEncoding(header string, present bool, offered []string) (string, bool) {
+	if !present || strings.TrimSpace(header) == "" {
+		return EncodingIdentity, true
+	}
+
+	accepted := parseAcceptEncoding(header)
+	wildcard, hasWildcard := accepted["*"]
+
+	best, bestQ := "", 0
+	for _, coding := range offered {
+		q, ok := accepted[coding]
+		if !ok {
+			switch {
+			case hasWildcard:
+				q = wildcard
+			case coding == EncodingIdentity:
+				q = 1
+			default:
+				q = 0
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best, bestQ > 0
+}
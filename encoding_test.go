@@ -0,0 +1,115 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQValue(t *testing.T) {
+	tests := []struct {
+		str string
+		q   int
+		ok  bool
+	}{
+		{"1", 1000, true},
+		{"1.", 1000, true},
+		{"1.000", 1000, true},
+		{"0", 0, true},
+		{"0.5", 500, true},
+		{"0.05", 50, true},
+		{"0.001", 1, true},
+		{"", 0, false},
+		{"1.001", 0, false},
+		{"2", 0, false},
+		{"0.0001", 0, false},
+		{".5", 0, false},
+		{"0,5", 0, false},
+		{"0.5x", 0, false},
+		{"-0.5", 0, false},
+	}
+
+	for _, tt := range tests {
+		q, ok := parseQValue(tt.str)
+		if q != tt.q || ok != tt.ok {
+			t.Errorf("parseQValue(%q): expected %d, %v but got %d, %v", tt.str, tt.q, tt.ok, q, ok)
+		}
+	}
+}
+
+func TestParseAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[string]int
+	}{
+		{"", map[string]int{}},
+		{"gzip, br", map[string]int{"gzip": 1000, "br": 1000}},
+		{"GZIP;Q=0.5, Br ; q=0.8", map[string]int{"gzip": 500, "br": 800}},
+		{"br;q=0", map[string]int{"br": 0}},
+		{"*;q=0, identity", map[string]int{"*": 0, "identity": 1000}},
+		{"br;q=2, gzip;q=abc, zstd", map[string]int{"zstd": 1000}},
+		{"br;level=1;q=0.3", map[string]int{"br": 300}},
+		{"gzip;q=0.2, gzip;q=0.9", map[string]int{"gzip": 200}},
+		{" , ,br", map[string]int{"br": 1000}},
+	}
+
+	for _, tt := range tests {
+		got := parseAcceptEncoding(tt.header)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAcceptEncoding(%q): expected %v but got %v", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		present bool
+		offered []string
+		want    string
+		ok      bool
+	}{
+		{name: "missing header", offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "empty header", present: true, offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "blank header", header: " ", present: true, offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "server preference", header: "gzip, br", present: true, offered: defaultEncodings, want: EncodingBrotli, ok: true},
+		{name: "server preference reversed", header: "br, gzip", present: true, offered: []string{EncodingGzip, EncodingBrotli}, want: EncodingGzip, ok: true},
+		{name: "client quality", header: "br;q=0.5, gzip", present: true, offered: defaultEncodings, want: EncodingGzip, ok: true},
+		{name: "br excluded", header: "br;q=0, gzip;q=0.1", present: true, offered: defaultEncodings, want: EncodingGzip, ok: true},
+		{name: "br only excluded", header: "br;q=0", present: true, offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "unknown coding", header: "compress", present: true, offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "wildcard", header: "*", present: true, offered: defaultEncodings, want: EncodingBrotli, ok: true},
+		{name: "wildcard below explicit", header: "*;q=0.5, gzip", present: true, offered: defaultEncodings, want: EncodingGzip, ok: true},
+		{name: "wildcard excludes all", header: "*;q=0", present: true, offered: defaultEncodings, ok: false},
+		{name: "wildcard excludes all but gzip", header: "*;q=0, gzip", present: true, offered: defaultEncodings, want: EncodingGzip, ok: true},
+		{name: "wildcard excludes all but identity", header: "*;q=0, identity", present: true, offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "identity excluded", header: "identity;q=0", present: true, offered: defaultEncodings, ok: false},
+		{name: "identity excluded with br", header: "identity;q=0, br", present: true, offered: defaultEncodings, want: EncodingBrotli, ok: true},
+		{name: "stored identity excluded", header: "identity;q=0, br", present: true, offered: identityOnly, ok: false},
+		{name: "invalid quality dropped", header: "br;q=1.5, gzip;q=0.1", present: true, offered: defaultEncodings, want: EncodingGzip, ok: true},
+		{name: "invalid quality only", header: "br;q=x", present: true, offered: defaultEncodings, want: EncodingIdentity, ok: true},
+		{name: "case insensitive", header: "GZip", present: true, offered: defaultEncodings, want: EncodingGzip, ok: true},
+	}
+
+	for _, tt := range tests {
+		got, ok := negotiateEncoding(tt.header, tt.present, tt.offered)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: negotiateEncoding(%q, %v, %v): expected %q, %v but got %q, %v", tt.name, tt.header, tt.present,
+				tt.offered, tt.want, tt.ok, got, ok)
+		}
+	}
+}
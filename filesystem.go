@@ -129,7 +129,7 @@ func (d dummyDir) Size() int64 {
 }
 
 func (d dummyDir) Mode() os.FileMode {
-	return os.ModePerm
+	return os.ModeDir | os.ModePerm
 }
 
 func (d dummyDir) ModTime() time.Time {
@@ -0,0 +1,124 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+)
+
+// fingerprintName inserts the first hex digits of the content hash before the extension of the base name, so
+// that /js/app.js becomes /js/app.3f9a1c2e.js and /LICENSE becomes /LICENSE.3f9a1c2e.
+func fingerprintName(name string, sha256 string) string {
+	if len(sha256) < minFingerprintLen {
+		return name
+	}
+
+	dir, file := path.Split(name)
+	ext := path.Ext(file)
+	if ext == file {
+		// hidden files like .htaccess have no extension but only a name
+		ext = ""
+	}
+
+	return dir + file[:len(file)-len(ext)] + "." + sha256[:minFingerprintLen] + ext
+}
+
+// unfingerprintName returns the candidate names from which the given name may have been derived by
+// fingerprintName. The caller must verify a candidate by comparing the hash.
+func unfingerprintName(name string) []string {
+	dir, file := path.Split(name)
+	var candidates []string
+
+	// /LICENSE.3f9a1c2e derived from /LICENSE
+	if ext := path.Ext(file); isFingerprintSegment(ext) {
+		candidates = append(candidates, dir+file[:len(file)-len(ext)])
+	}
+
+	// /app.3f9a1c2e.js derived from /app.js
+	ext := path.Ext(file)
+	stem := file[:len(file)-len(ext)]
+	if hash := path.Ext(stem); ext != "" && isFingerprintSegment(hash) {
+		candidates = append(candidates, dir+stem[:len(stem)-len(hash)]+ext)
+	}
+
+	return candidates
+}
+
+// isFingerprintSegment reports whether str looks like .3f9a1c2e
+func isFingerprintSegment(str string) bool {
+	if len(str) != minFingerprintLen+1 || str[0] != '.' {
+		return false
+	}
+
+	for _, r := range str[1:] {
+		if !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'f')) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// URL returns the fingerprinted alias of the named resource, e.g. /app.3f9a1c2e.js for /app.js. The handler
+// serves the resource under both names and caches the alias as immutable. If no such resource exists, the
+// name is returned unchanged.
+func (b *Bundle) URL(name string) string {
+	res := b.Find(name)
+	if res == nil {
+		return name
+	}
+
+	return fingerprintName(res.name, res.sha256String)
+}
+
+// Manifest returns the fingerprinted aliases of all resources, using names without the leading slash, e.g.
+// "js/app.js": "js/app.3f9a1c2e.js". This is the flat format of the rev-manifest.json or the
+// webpack-manifest-plugin.
+func (b *Bundle) Manifest() map[string]string {
+	res := make(map[string]string, len(b.resources))
+	for _, r := range b.resources {
+		r = b.refresh(r)
+		addManifestEntry(res, r.name, r.sha256String)
+	}
+	return res
+}
+
+// WriteManifest writes the Manifest as indented json.
+func (b *Bundle) WriteManifest(w io.Writer) error {
+	return writeManifest(w, b.Manifest())
+}
+
+func addManifestEntry(manifest map[string]string, name string, sha256 string) {
+	manifest[strings.TrimPrefix(name, "/")] = strings.TrimPrefix(fingerprintName(name, sha256), "/")
+}
+
+// encodeManifest returns the json of the manifest, as written by writeManifest.
+func encodeManifest(manifest map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	if err := writeManifest(buf, manifest); err != nil {
+		panic(err) // cannot happen for a string map and an in-memory buffer
+	}
+	return buf.Bytes()
+}
+
+func writeManifest(w io.Writer, manifest map[string]string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest) // map keys are sorted, so the output is stable
+}
@@ -0,0 +1,345 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errNotDir = errors.New("not a directory")
+	errIsDir  = errors.New("is a directory")
+)
+
+// The Bundle is a read-only file system. Resource names like /css/app.css are available
+// as css/app.css and directories are synthesized from the resource names.
+var (
+	_ fs.FS         = (*Bundle)(nil)
+	_ fs.ReadDirFS  = (*Bundle)(nil)
+	_ fs.ReadFileFS = (*Bundle)(nil)
+	_ fs.StatFS     = (*Bundle)(nil)
+	_ fs.GlobFS     = (*Bundle)(nil)
+	_ fs.SubFS      = (*Bundle)(nil)
+)
+
+// Open implements fs.FS.
+func (b *Bundle) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if res := b.Find(resourceName(name)); res != nil {
+		return &fsFile{res: res, reader: bytes.NewReader(res.unpack())}, nil
+	}
+
+	entries, ok := b.readDir(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &fsDir{name: name, entries: entries}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (b *Bundle) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if b.Find(resourceName(name)) != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	entries, ok := b.readDir(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS and returns a defensive copy of the unpacked data.
+func (b *Bundle) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	res := b.Find(resourceName(name))
+	if res == nil {
+		if _, ok := b.readDir(name); ok {
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+		}
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return res.AsBytes(), nil
+}
+
+// Stat implements fs.StatFS.
+func (b *Bundle) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if res := b.Find(resourceName(name)); res != nil {
+		return fsFileInfo{res: res}, nil
+	}
+
+	if _, ok := b.readDir(name); ok {
+		return dummyDir{name: path.Base(name)}, nil
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// Glob implements fs.GlobFS and matches files and synthesized directories.
+func (b *Bundle) Glob(pattern string) ([]string, error) {
+	// validate the pattern upfront, path.Match only reports bad patterns lazily
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	dirs := map[string]bool{}
+	for _, r := range b.resources {
+		name := fsName(r.name)
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if ok, _ := path.Match(pattern, dir); ok {
+				matches = append(matches, dir)
+			}
+		}
+	}
+
+	if pattern == "." {
+		matches = append(matches, ".")
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// Sub implements fs.SubFS and returns a new bundle containing only the resources below dir, which are
+// renamed accordingly. The current bundle is unchanged.
+func (b *Bundle) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+
+	if dir == "." {
+		return b, nil
+	}
+
+	if b.Find(resourceName(dir)) != nil {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errNotDir}
+	}
+
+	prefix := resourceName(dir) + "/"
+	var resources []*Resource
+	for _, r := range b.resources[b.searchPrefix(prefix):] {
+		if !strings.HasPrefix(r.name, prefix) {
+			break
+		}
+		resources = append(resources, r.rename(r.name[len(prefix)-1:]))
+	}
+
+	return b.derive(resources), nil
+}
+
+// readDir synthesizes the sorted directory entries of the given valid fs path. It returns false, if no such
+// directory exists.
+func (b *Bundle) readDir(name string) ([]fs.DirEntry, bool) {
+	prefix := "/"
+	if name != "." {
+		prefix = resourceName(name) + "/"
+	}
+
+	var entries []fs.DirEntry
+	found := name == "."
+	lastDir := ""
+	for _, r := range b.resources[b.searchPrefix(prefix):] {
+		if !strings.HasPrefix(r.name, prefix) {
+			break
+		}
+
+		found = true
+		child := r.name[len(prefix):]
+		if idx := strings.IndexByte(child, '/'); idx >= 0 {
+			child = child[:idx]
+			if child != lastDir {
+				lastDir = child
+				entries = append(entries, dirEntry{info: dummyDir{name: child}})
+			}
+			continue
+		}
+
+		entries = append(entries, dirEntry{info: fsFileInfo{res: b.refresh(r)}})
+	}
+
+	// resource order is not directory order, e.g. /a.txt sorts before /a/b.txt but after /a
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, found
+}
+
+// searchPrefix returns the index of the first resource whose name is not less than prefix.
+func (b *Bundle) searchPrefix(prefix string) int {
+	return sort.Search(len(b.resources), func(i int) bool {
+		return b.resources[i].name >= prefix
+	})
+}
+
+// resourceName converts a fs path like css/app.css into a resource name like /css/app.css
+func resourceName(name string) string {
+	if name == "." {
+		return "/"
+	}
+	return "/" + name
+}
+
+// fsName converts a resource name like /css/app.css into a fs path like css/app.css
+func fsName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+type fsFile struct {
+	res    *Resource
+	reader *bytes.Reader
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return fsFileInfo{res: f.res}, nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	return f.reader.Read(p)
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.reader.ReadAt(p, off)
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *fsFile) Close() error {
+	return nil
+}
+
+type fsDir struct {
+	name    string
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return dummyDir{name: path.Base(d.name)}, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDir}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := len(d.entries) - d.offset
+	if count > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+
+	if count <= 0 || count > remaining {
+		count = remaining
+	}
+
+	res := make([]fs.DirEntry, count)
+	copy(res, d.entries[d.offset:d.offset+count])
+	d.offset += count
+	return res, nil
+}
+
+// fsFileInfo adapts a Resource, whose Name is the full path, to the base name semantic of fs.FileInfo.
+type fsFileInfo struct {
+	res *Resource
+}
+
+func (f fsFileInfo) Name() string {
+	return path.Base(f.res.name)
+}
+
+func (f fsFileInfo) Size() int64 {
+	return f.res.Size()
+}
+
+func (f fsFileInfo) Mode() fs.FileMode {
+	return f.res.Mode() &^ fs.ModeType
+}
+
+func (f fsFileInfo) ModTime() time.Time {
+	return f.res.ModTime()
+}
+
+func (f fsFileInfo) IsDir() bool {
+	return false
+}
+
+func (f fsFileInfo) Sys() interface{} {
+	return nil
+}
+
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (d dirEntry) Name() string {
+	return d.info.Name()
+}
+
+func (d dirEntry) IsDir() bool {
+	return d.info.IsDir()
+}
+
+func (d dirEntry) Type() fs.FileMode {
+	return d.info.Mode().Type()
+}
+
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	return d.info, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"io/fs"
+	"path"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// testBundle contains nested directories and /a.txt, which sorts between the directory /a and its children.
+func testBundle() *Bundle {
+	var resources []*Resource
+	for _, name := range []string{"/a.txt", "/a/b.txt", "/a/c/d.txt", "/a/c/e.txt", "/a-b.txt", "/z.txt"} {
+		resources = append(resources, NewResourceFromBytes(name, []byte("content of "+name)))
+	}
+	return Make(resources...)
+}
+
+func TestFS(t *testing.T) {
+	if err := fstest.TestFS(testBundle(), "a.txt", "a/b.txt", "a/c/d.txt", "a/c/e.txt", "a-b.txt", "z.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubFS(t *testing.T) {
+	sub, err := fs.Sub(testBundle(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(sub, "b.txt", "c/d.txt", "c/e.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat(sub, "a.txt"); err == nil {
+		t.Fatal("a.txt must not be visible below a")
+	}
+}
+
+func TestReadDirOrder(t *testing.T) {
+	entries, err := fs.ReadDir(testBundle(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	want := []string{"a", "a-b.txt", "a.txt", "z.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %v but got %v", want, names)
+	}
+
+	if !entries[0].IsDir() || entries[2].IsDir() {
+		t.Fatalf("expected a to be a directory and a.txt to be a file")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	b := testBundle()
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*", []string{"a", "a-b.txt", "a.txt", "z.txt"}},
+		{"a", []string{"a"}},
+		{"a/*", []string{"a/b.txt", "a/c"}},
+		{"*/c", []string{"a/c"}},
+		{"a/c/*.txt", []string{"a/c/d.txt", "a/c/e.txt"}},
+		{"*/*/d.txt", []string{"a/c/d.txt"}},
+		{"a?*", []string{"a-b.txt", "a.txt"}},
+		{"x/*", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := b.Glob(tt.pattern)
+		if err != nil {
+			t.Fatalf("Glob(%q): %v", tt.pattern, err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Glob(%q): expected %v but got %v", tt.pattern, tt.want, got)
+		}
+
+		// fs.Glob uses the GlobFS implementation, so compare with the generic algorithm
+		if generic, _ := fs.Glob(fsOnly{b}, tt.pattern); !reflect.DeepEqual(generic, got) {
+			t.Errorf("Glob(%q): differs from the generic result %v", tt.pattern, generic)
+		}
+	}
+
+	if _, err := b.Glob("a/["); err != path.ErrBadPattern {
+		t.Errorf("expected ErrBadPattern but got %v", err)
+	}
+}
+
+// fsOnly hides all optional interfaces of the bundle, so that the generic fs algorithms are used.
+type fsOnly struct {
+	fsys fs.FS
+}
+
+func (f fsOnly) Open(name string) (fs.File, error) {
+	return f.fsys.Open(name)
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// FuncMap returns the template functions asset, integrity and inline for the resources of this bundle.
+// The prefix is the path where the handler is mounted, e.g. /static, and is prepended to all asset urls.
+//
+//	<link rel="stylesheet" href="{{asset "/app.css"}}" integrity="{{integrity "/app.css"}}">
+//	<style>{{inline "/critical.css"}}</style>
+//
+// The functions fail the template execution, if the named resource does not exist.
+func (b *Bundle) FuncMap(prefix string) template.FuncMap {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	return template.FuncMap{
+		"asset": func(name string) (string, error) {
+			res, err := b.findOrErr(name)
+			if err != nil {
+				return "", err
+			}
+			return prefix + fingerprintName(res.name, res.sha256String), nil
+		},
+		"integrity": func(name string) (string, error) {
+			res, err := b.findOrErr(name)
+			if err != nil {
+				return "", err
+			}
+			return res.Integrity("sha384"), nil
+		},
+		"inline": func(name string) (interface{}, error) {
+			res, err := b.findOrErr(name)
+			if err != nil {
+				return "", err
+			}
+			return inline(res)
+		},
+	}
+}
+
+// findOrErr returns the named resource or an error, if it does not exist.
+func (b *Bundle) findOrErr(name string) (*Resource, error) {
+	res := b.Find(name)
+	if res == nil {
+		return nil, fmt.Errorf("resource '%s' not found", name)
+	}
+	return res, nil
+}
+
+// inline returns the content of the resource typed for the html/template context, it is used in. Bundled
+// resources are trusted, however the content must not be able to terminate its own style or script element.
+// Everything else is returned as string and escaped by the template.
+func inline(res *Resource) (interface{}, error) {
+	str := res.AsString()
+	switch strings.ToLower(path.Ext(res.name)) {
+	case ".css":
+		if strings.Contains(strings.ToLower(str), "</style") {
+			return nil, fmt.Errorf("resource '%s' cannot be inlined: contains </style", res.name)
+		}
+		return template.CSS(str), nil
+	case ".js", ".mjs":
+		if strings.Contains(strings.ToLower(str), "</script") {
+			return nil, fmt.Errorf("resource '%s' cannot be inlined: contains </script", res.name)
+		}
+		return template.JS(str), nil
+	case ".html", ".htm", ".svg":
+		return template.HTML(str), nil
+	default:
+		return str, nil
+	}
+}
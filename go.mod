@@ -1,5 +1,9 @@
 module github.com/golangee/bundle
 
-go 1.14
+go 1.16
 
-require github.com/andybalholm/brotli v1.0.0
+require (
+	github.com/andybalholm/brotli v1.0.0
+	github.com/klauspost/compress v1.15.15
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -17,6 +17,8 @@ package bundle
 import (
 	"net/http"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -41,65 +43,330 @@ var mimeTypes = map[string]string{
 	".ttf":  "font/ttf",
 }
 
-// Handle is currently a trivial implementation for delivering resources, however
-// it will use the resources to support gzip and brotli compression and more importantly etags.
-// It simply matches the url path against the name of a resource.
-func Handle(prefix string, resources ...*Resource) func(http.ResponseWriter, *http.Request) {
-	files := make(map[string]*Resource)
+// HandlerOption configures the handler returned by Bundle.Handler.
+type HandlerOption func(h *handler)
+
+// WithEncodings sets the content codings which may be served, in order of preference. The preference is used
+// to break ties between codings which are rated equally by the client, e.g. for "Accept-Encoding: gzip, br".
+// Identity is always available as the last resort, unless excluded by the client. Codings without a registered
+// Codec are ignored. The default is br, gzip, use e.g. WithEncodings("zstd", "br", "gzip") to serve zstd.
+// Resources, which have been stored without compression, are always served with identity.
+func WithEncodings(encodings ...string) HandlerOption {
+	return func(h *handler) {
+		h.encodings = nil
+		for _, enc := range encodings {
+			enc = strings.ToLower(enc)
+			if _, ok := LookupCodec(enc); ok {
+				h.encodings = append(h.encodings, enc)
+			}
+		}
+		h.encodings = append(h.encodings, EncodingIdentity)
+	}
+}
+
+// WithCacheControl sets the Cache-Control header value of all successful responses, which are neither
+// matched by a cache rule nor fingerprinted. The default is no-cache, so that clients always revalidate
+// using the etag.
+func WithCacheControl(value string) HandlerOption {
+	return func(h *handler) {
+		h.cacheControl = value
+	}
+}
+
+// WithNotFound sets the name of a resource, which is served with status 404 for unknown paths, instead
+// of the plain text response of http.NotFound.
+func WithNotFound(name string) HandlerOption {
+	return func(h *handler) {
+		h.notFound = name
+	}
+}
+
+// WithIndex sets the names of the files, which are tried in order for paths ending with a slash.
+// The default is index.html, index.htm.
+func WithIndex(names ...string) HandlerOption {
+	return func(h *handler) {
+		h.index = names
+	}
+}
+
+// WithHeader adds the given header to all responses, e.g. a Content-Security-Policy. It may be given
+// multiple times.
+func WithHeader(key, value string) HandlerOption {
+	return func(h *handler) {
+		h.headers.Add(key, value)
+	}
+}
+
+// WithMimeType sets or overrides the content type for the given file extension, e.g. ".md" and "text/markdown".
+func WithMimeType(ext, contentType string) HandlerOption {
+	return func(h *handler) {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		h.mimeTypes[strings.ToLower(ext)] = contentType
+	}
+}
+
+// SPAOptions configures the single page application mode of a handler.
+type SPAOptions struct {
+	// Fallback is the name of the resource which is served for unknown paths. Defaults to /index.html.
+	Fallback string
+	// Exclude contains regular expressions of paths which must never fall back, e.g. ^/api/.
+	Exclude []string
+	// IncludeFileExtensions also falls back for paths with a file extension like /missing.js, which
+	// are excluded by default, because they are most likely no deep links but missing assets.
+	IncludeFileExtensions bool
+}
+
+// WithSPA enables the single page application mode, so that unknown paths like /settings/profile are answered
+// with the fallback resource instead of 404 and deep links just work. The fallback is always served with
+// no-cache, so that a new deployment is picked up immediately. It panics, if an exclusion pattern is invalid.
+func WithSPA(opts SPAOptions) HandlerOption {
+	s := &spa{
+		fallback:       opts.Fallback,
+		withExtensions: opts.IncludeFileExtensions,
+	}
+
+	if s.fallback == "" {
+		s.fallback = "/index.html"
+	}
+
+	for _, exclude := range opts.Exclude {
+		s.excludes = append(s.excludes, regexp.MustCompile(exclude))
+	}
+
+	return func(h *handler) {
+		h.spa = s
+	}
+}
+
+type spa struct {
+	fallback       string
+	excludes       []*regexp.Regexp
+	withExtensions bool
+}
+
+// fallsBack reports whether the given unknown path should be answered with the fallback resource.
+func (s *spa) fallsBack(path string) bool {
+	if !s.withExtensions && filepath.Ext(path) != "" {
+		return false
+	}
+
+	for _, exclude := range s.excludes {
+		if exclude.MatchString(path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withDev enables the development mode of the handler.
+func withDev(dev *devMode) HandlerOption {
+	return func(h *handler) {
+		h.dev = dev
+	}
+}
+
+type handler struct {
+	prefix       string
+	resources    []*Resource
+	files        map[string]*Resource
+	encodings    []string
+	spa          *spa
+	cacheControl string
+	cacheRules   []cacheRule
+	notFound     string
+	index        []string
+	headers      http.Header
+	mimeTypes    map[string]string
+	dev          *devMode
+	liveReload   string
+}
+
+func newHandler(prefix string, resources []*Resource, opts ...HandlerOption) *handler {
+	h := &handler{
+		prefix:       prefix,
+		resources:    resources,
+		files:        make(map[string]*Resource),
+		encodings:    defaultEncodings,
+		cacheControl: "no-cache",
+		index:        []string{"index.html", "index.htm"},
+		headers:      http.Header{},
+		mimeTypes:    make(map[string]string),
+	}
+
 	for _, r := range resources {
-		files[r.name] = r
+		h.files[r.name] = r
 	}
 
-	return func(writer http.ResponseWriter, request *http.Request) {
-		path := request.URL.Path
-		if strings.HasPrefix(path, prefix) {
-			path = path[len(prefix):]
-			if !strings.HasPrefix(path, "/") {
-				path = "/" + path
-			}
+	for ext, contentType := range mimeTypes {
+		h.mimeTypes[ext] = contentType
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Handle serves the resources by matching the url path below the prefix against their names, including
+// content hash fingerprinted aliases. The content coding is negotiated from Accept-Encoding. Single and multiple
+// byte ranges are served uncompressed, so that seeking in media files and resuming downloads works. Conditional
+// requests are evaluated against the strong etag and the modification date of the resource.
+// Use Bundle.Handler to customize the behavior with options.
+func Handle(prefix string, resources ...*Resource) http.HandlerFunc {
+	return newHandler(prefix, resources).ServeHTTP
+}
+
+// resolve finds the resource for the given path and the status code to respond with. Fallback is true,
+// if the resource has been selected by the single page application mode.
+func (h *handler) resolve(path string) (resource *Resource, status int, fallback bool) {
+	if resource := h.lookup(path); resource != nil {
+		return resource, http.StatusOK, false
+	}
+
+	for _, name := range unfingerprintName(path) {
+		if resource := h.lookup(name); resource != nil && fingerprintName(name, resource.sha256String) == path {
+			return resource, http.StatusOK, false
 		}
+	}
 
-		resource := files[path]
-		if resource == nil {
-			if path == "/" {
-				resource = files["/index.html"]
-				if resource == nil {
-					resource = files["/index.htm"]
-				}
+	if strings.HasSuffix(path, "/") {
+		for _, index := range h.index {
+			if resource := h.lookup(path + index); resource != nil {
+				return resource, http.StatusOK, false
 			}
+		}
+	}
 
-			if resource == nil {
-				http.NotFound(writer, request)
-				return
-			}
+	if h.spa != nil && h.spa.fallsBack(path) {
+		if resource := h.lookup(h.spa.fallback); resource != nil {
+			return resource, http.StatusOK, true
+		}
+	}
+
+	if h.notFound != "" {
+		if resource := h.lookup(h.notFound); resource != nil {
+			return resource, http.StatusNotFound, false
 		}
+	}
+
+	return nil, http.StatusNotFound, false
+}
+
+// lookup returns the named resource or nil. In development mode, it reflects the original file.
+func (h *handler) lookup(name string) *Resource {
+	resource := h.files[name]
+	if resource != nil && h.dev != nil {
+		resource = h.dev.refresh(resource)
+	}
+	return resource
+}
+
+func (h *handler) contentType(resource *Resource) string {
+	contentType := h.mimeTypes[strings.ToLower(filepath.Ext(resource.Name()))]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType
+}
+
+func (h *handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	for key, values := range h.headers {
+		writer.Header()[key] = append([]string(nil), values...)
+	}
 
-		contentType := mimeTypes[strings.ToLower(filepath.Ext(resource.Name()))]
-		if contentType == "" {
-			contentType = "application/octet"
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := request.URL.Path
+	if strings.HasPrefix(path, h.prefix) {
+		path = path[len(h.prefix):]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
 		}
+	}
+
+	if h.dev != nil && h.liveReload != "" && path == h.liveReload {
+		h.serveLiveReload(writer, request)
+		return
+	}
+
+	resource, status, fallback := h.resolve(path)
+	if resource == nil {
+		http.NotFound(writer, request)
+		return
+	}
 
-		writer.Header().Set("content-type", contentType)
+	contentType := h.contentType(resource)
+	if h.dev != nil && h.liveReload != "" && strings.HasPrefix(contentType, "text/html") {
+		resource = h.injectLiveReload(resource)
+	}
+	writer.Header().Set("content-type", contentType)
+	if status == http.StatusOK {
+		writer.Header().Set("accept-ranges", "bytes")
+	}
+
+	// deep links and error pages must always revalidate, even if assets are cached more aggressively
+	if status == http.StatusOK && !fallback {
+		writer.Header().Set("cache-control", h.cachePolicy(path, resource))
+	} else {
 		writer.Header().Set("cache-control", "no-cache")
-		writer.Header().Set("etag", resource.sha256String)
+	}
+
+	if len(h.encodings) > 1 {
+		writer.Header().Add("vary", "Accept-Encoding")
+	}
 
-		etag := request.Header.Get("If-None-Match")
-		if etag == resource.sha256String {
-			writer.WriteHeader(http.StatusNotModified)
+	offered := h.encodings
+	if resource.stored() {
+		offered = identityOnly
+	}
+
+	acceptEncoding, present := request.Header["Accept-Encoding"]
+	encoding, ok := negotiateEncoding(strings.Join(acceptEncoding, ","), present, offered)
+	if !ok {
+		http.Error(writer, "no acceptable content coding", http.StatusNotAcceptable)
+		return
+	}
+
+	if status == http.StatusOK {
+		// partial content is always served from the unpacked variant
+		if request.Header.Get("Range") != "" && ifRangeMatches(request, resource) {
+			encoding = EncodingIdentity
+		}
+
+		etag := resource.etag(encoding)
+		writer.Header().Set("etag", etag)
+		if !isZeroTime(resource.lastMod) {
+			writer.Header().Set("last-modified", resource.lastMod.UTC().Format(http.TimeFormat))
+		}
+
+		if checkPreconditions(writer, request, etag, resource.lastMod) {
 			return
 		}
 
-		if strings.Contains(request.Header.Get("Accept-Encoding"), "br") {
-			writer.Header().Set("Content-Encoding", "br")
-			writer.Write(resource.brotli())
+		if encoding == EncodingIdentity && serveRange(writer, request, resource, contentType) {
 			return
-		} else {
-			if strings.Contains(request.Header.Get("Accept-Encoding"), "gzip") {
-				writer.Header().Set("Content-Encoding", "gzip")
-				writer.Write(resource.gzip())
-			} else {
-				writer.Write(resource.unpack())
-			}
 		}
 	}
+
+	var body []byte
+	if encoding == EncodingIdentity {
+		body = resource.unpack()
+	} else {
+		writer.Header().Set("Content-Encoding", encoding)
+		body = resource.variant(encoding)
+	}
+
+	writer.Header().Set("content-length", strconv.Itoa(len(body)))
+	writer.WriteHeader(status)
+	if request.Method != http.MethodHead {
+		writer.Write(body)
+	}
 }
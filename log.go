@@ -0,0 +1,205 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LogLevel controls which events are printed, if no Options.OnEvent callback is set.
+type LogLevel int
+
+const (
+	// LogQuiet prints only errors, which did not stop the generator, e.g. while watching.
+	LogQuiet LogLevel = -1
+	// LogNormal prints whether a bundle has been written or skipped. This is the default.
+	LogNormal LogLevel = 0
+	// LogVerbose additionally prints every discovered, compressed, cached, stored and deduplicated file.
+	LogVerbose LogLevel = 1
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogQuiet:
+		return "quiet"
+	case LogNormal:
+		return "normal"
+	case LogVerbose:
+		return "verbose"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// MarshalText returns the name of the level.
+func (l LogLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses quiet, normal or verbose.
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "quiet":
+		*l = LogQuiet
+	case "normal", "":
+		*l = LogNormal
+	case "verbose":
+		*l = LogVerbose
+	default:
+		return fmt.Errorf("unsupported log level '%s', expected quiet, normal or verbose", string(text))
+	}
+	return nil
+}
+
+// EventKind classifies an Event.
+type EventKind int
+
+const (
+	// EventDiscovered is emitted for each file, which will be included.
+	EventDiscovered EventKind = iota + 1
+	// EventCompressed is emitted for each file, after it has been compressed.
+	EventCompressed
+	// EventDeduplicated is emitted for each file, whose content is already contained in the bundle.
+	EventDeduplicated
+	// EventSkipped is emitted, if the generated file is already up to date.
+	EventSkipped
+	// EventWritten is emitted for each written file, i.e. the generated source and the manifest.
+	EventWritten
+	// EventError is emitted for errors, which do not stop the generator, e.g. while watching.
+	EventError
+	// EventCached is emitted for each file, whose compressed variant has been taken from the compression cache.
+	EventCached
+	// EventStored is emitted for each file, which is embedded without compression, because it is already
+	// compressed or does not compress well.
+	EventStored
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventDiscovered:
+		return "discovered"
+	case EventCompressed:
+		return "compressed"
+	case EventCached:
+		return "cached"
+	case EventStored:
+		return "stored"
+	case EventDeduplicated:
+		return "deduplicated"
+	case EventSkipped:
+		return "skipped"
+	case EventWritten:
+		return "written"
+	case EventError:
+		return "error"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// level returns the lowest LogLevel, which prints events of this kind.
+func (k EventKind) level() LogLevel {
+	switch k {
+	case EventError:
+		return LogQuiet
+	case EventSkipped, EventWritten:
+		return LogNormal
+	default:
+		return LogVerbose
+	}
+}
+
+// Event describes the progress of the generator.
+type Event struct {
+	Kind           EventKind
+	Bundle         string // name of the bundle within a Config, if any
+	File           string // absolute name of the affected file
+	Name           string // resource name, if the file is included
+	Size           int64  // size of the file in bytes
+	CompressedSize int64  // size of the compressed variant, only for EventCompressed, EventCached, EventStored and EventDeduplicated
+	Details        string // optional human readable details, e.g. a summary of the changed resources
+	Err            error  // only for EventError
+}
+
+// Ratio returns the compressed size relative to the original size or 0, if unknown.
+func (e Event) Ratio() float64 {
+	if e.Size == 0 || e.CompressedSize == 0 {
+		return 0
+	}
+	return float64(e.CompressedSize) / float64(e.Size)
+}
+
+// String returns a human readable line.
+func (e Event) String() string {
+	sb := &strings.Builder{}
+	if e.Bundle != "" {
+		sb.WriteString("bundle '" + e.Bundle + "': ")
+	}
+
+	switch e.Kind {
+	case EventDiscovered:
+		fmt.Fprintf(sb, "found %s (%d bytes)", e.File, e.Size)
+	case EventCompressed:
+		fmt.Fprintf(sb, "compressed %s: %d -> %d bytes (%.1f%%)", e.Name, e.Size, e.CompressedSize, e.Ratio()*100)
+	case EventCached:
+		fmt.Fprintf(sb, "cached %s: %d -> %d bytes (%.1f%%)", e.Name, e.Size, e.CompressedSize, e.Ratio()*100)
+	case EventStored:
+		fmt.Fprintf(sb, "stored %s: %d bytes without compression", e.Name, e.Size)
+	case EventDeduplicated:
+		fmt.Fprintf(sb, "deduplicated %s: %d bytes", e.Name, e.Size)
+	case EventSkipped:
+		fmt.Fprintf(sb, "%s is already up to date, nothing to do", e.File)
+	case EventWritten:
+		fmt.Fprintf(sb, "wrote %s (%d bytes)", e.File, e.Size)
+	case EventError:
+		fmt.Fprintf(sb, "%v", e.Err)
+	default:
+		fmt.Fprintf(sb, "%s %s", e.Kind, e.File)
+	}
+
+	if e.Details != "" {
+		sb.WriteString(", " + e.Details)
+	}
+
+	return sb.String()
+}
+
+// emit passes the event to OnEvent or prints it to stderr, if the LogLevel permits.
+func (o Options) emit(e Event) {
+	if o.OnEvent != nil {
+		o.OnEvent(e)
+		return
+	}
+
+	if o.LogLevel < e.Kind.level() {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, e)
+}
+
+// options returns the options of the bundle, whose events are tagged with the bundle name.
+func (b BundleConfig) options() Options {
+	opts := b.Options
+	next := opts.emit
+	opts.OnEvent = func(e Event) {
+		e.Bundle = b.Name
+		next(e)
+	}
+
+	return opts
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+)
+
+// genFile is the information, which can be recovered from an existing bundle.gen.go file.
+type genFile struct {
+	Version   string
+	Resources map[string]genResource // by name
+	Blobs     map[string]string      // blob constant name to the unquoted encoded data
+}
+
+// genResource is a single bundle.NewResource call of a generated file.
+type genResource struct {
+	Name      string
+	Size      int64
+	Sha256    string
+	ConstName string
+	Encoding  string // blob encoding from the chained WithMeta call, empty for ascii85
+	Codec     string // storage codec from the chained WithMeta call, empty for the DefaultCodec
+	GzipConst string // name of the embedded gzip variant from the chained WithMeta call, if any
+}
+
+// parseGenFile parses a generated file. It fails, if the file is not a syntactically valid go file.
+func parseGenFile(fname string) (*genFile, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), fname, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &genFile{
+		Resources: map[string]genResource{},
+		Blobs:     map[string]string{},
+	}
+
+	var inspectErr error
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ValueSpec:
+			if len(n.Names) != 1 || len(n.Values) != 1 {
+				return true
+			}
+
+			lit, ok := n.Values[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+
+			str, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				inspectErr = err
+				return false
+			}
+
+			if n.Names[0].Name == "BundleVersion" {
+				res.Version = str
+			} else {
+				res.Blobs[n.Names[0].Name] = str
+			}
+		case *ast.CallExpr:
+			r, ok, err := parseResourceCall(n)
+			if err != nil {
+				inspectErr = fmt.Errorf("%s: %w", fname, err)
+				return false
+			}
+
+			if ok {
+				res.Resources[r.Name] = r
+				return false // a chained NewResource call has already been parsed
+			}
+		}
+		return true
+	})
+
+	if inspectErr != nil {
+		return nil, inspectErr
+	}
+
+	return res, nil
+}
+
+// parseResourceCall interprets a generated bundle.NewResource call, which is optionally chained with WithMeta.
+func parseResourceCall(call *ast.CallExpr) (genResource, bool, error) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return genResource{}, false, nil
+	}
+
+	switch {
+	case sel.Sel.Name == "NewResource" && len(call.Args) >= 9:
+		r, err := parseNewResource(call.Args)
+		return r, err == nil, err
+	case sel.Sel.Name == "WithMeta" && len(call.Args) == 1:
+		inner, ok := sel.X.(*ast.CallExpr)
+		if !ok {
+			return genResource{}, false, nil
+		}
+
+		r, ok, err := parseResourceCall(inner)
+		if !ok || err != nil {
+			return r, ok, err
+		}
+
+		meta := metaFields(call.Args[0])
+		if value, ok := meta["Encoding"]; ok {
+			if r.Encoding, err = stringLit(value); err != nil {
+				return r, false, err
+			}
+		}
+
+		if value, ok := meta["Codec"]; ok {
+			if r.Codec, err = stringLit(value); err != nil {
+				return r, false, err
+			}
+		}
+
+		if ident, ok := meta["Gzip"].(*ast.Ident); ok {
+			r.GzipConst = ident.Name
+		}
+
+		return r, true, nil
+	default:
+		return genResource{}, false, nil
+	}
+}
+
+// metaFields returns the values of a bundle.Meta literal by field name.
+func metaFields(expr ast.Expr) map[string]ast.Expr {
+	res := map[string]ast.Expr{}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return res
+	}
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+
+		if key, ok := kv.Key.(*ast.Ident); ok {
+			res[key.Name] = kv.Value
+		}
+	}
+
+	return res
+}
+
+// parseNewResource interprets the literal arguments of a generated bundle.NewResource call.
+func parseNewResource(args []ast.Expr) (genResource, error) {
+	var r genResource
+	var err error
+
+	if r.Name, err = stringLit(args[0]); err != nil {
+		return r, err
+	}
+
+	size, ok := args[1].(*ast.BasicLit)
+	if !ok || size.Kind != token.INT {
+		return r, fmt.Errorf("resource '%s': size is not an int literal", r.Name)
+	}
+
+	if r.Size, err = strconv.ParseInt(size.Value, 10, 64); err != nil {
+		return r, err
+	}
+
+	if r.Sha256, err = stringLit(args[4]); err != nil {
+		return r, err
+	}
+
+	if ident, ok := args[8].(*ast.Ident); ok {
+		r.ConstName = ident.Name
+	}
+
+	return r, nil
+}
+
+func stringLit(expr ast.Expr) (string, error) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", fmt.Errorf("expected a string literal")
+	}
+	return strconv.Unquote(lit.Value)
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errUnsatisfiableRange = errors.New("unsatisfiable range")
+
+// byteRange is a resolved and inclusive range of a representation.
+type byteRange struct {
+	start, end int64
+}
+
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// parseRange parses a Range header value like "bytes=0-99,200-,-50" (RFC 9110 section 14.1.2) against the
+// given representation size. Ranges which are not satisfiable are dropped and if none remains,
+// errUnsatisfiableRange is returned. Any other error denotes a syntactically invalid header, which should be
+// ignored by the caller.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	const unit = "bytes="
+	if !strings.HasPrefix(header, unit) {
+		return nil, errors.New("invalid range unit")
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(header[len(unit):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		idx := strings.IndexByte(spec, '-')
+		if idx < 0 {
+			return nil, errors.New("invalid range")
+		}
+
+		first, last := strings.TrimSpace(spec[:idx]), strings.TrimSpace(spec[idx+1:])
+		var r byteRange
+		if first == "" {
+			// suffix range, e.g. -500 means the last 500 bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid suffix range")
+			}
+
+			if n == 0 || size == 0 {
+				continue
+			}
+
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, end: size - 1}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range start")
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errors.New("invalid range end")
+				}
+
+				if end >= size {
+					end = size - 1
+				}
+			}
+
+			if start >= size {
+				continue
+			}
+			r = byteRange{start: start, end: end}
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+
+	return ranges, nil
+}
+
+// ifRangeMatches evaluates the If-Range precondition (RFC 9110 section 13.1.5). Only a strong comparison of the
+// entity tag or an exact match of the last modification date allows a partial response.
+func ifRangeMatches(request *http.Request, resource *Resource) bool {
+	ifRange := strings.TrimSpace(request.Header.Get("If-Range"))
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etagStrongMatch(ifRange, resource.etag(EncodingIdentity))
+	}
+
+	date, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+
+	return !isZeroTime(resource.lastMod) && resource.lastMod.Truncate(time.Second).Equal(date)
+}
+
+// serveRange answers a GET request carrying a Range header from the unpacked variant with a 206 or 416 status.
+// It returns false, if the request must be answered with the full representation instead. HEAD requests
+// are always answered with the full representation, as recommended by RFC 9110.
+func serveRange(writer http.ResponseWriter, request *http.Request, resource *Resource, contentType string) bool {
+	header := request.Header.Get("Range")
+	if header == "" || request.Method != http.MethodGet || !ifRangeMatches(request, resource) {
+		return false
+	}
+
+	size := resource.Size()
+	ranges, err := parseRange(header, size)
+	if err == errUnsatisfiableRange {
+		writer.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(writer, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+
+	if err != nil {
+		return false
+	}
+
+	// a client asking for more than the entire representation is better served by a full response
+	sum := int64(0)
+	for _, r := range ranges {
+		sum += r.length()
+	}
+	if sum > size {
+		return false
+	}
+
+	buf := resource.unpack()
+	if len(ranges) == 1 {
+		r := ranges[0]
+		writer.Header().Set("Content-Range", r.contentRange(size))
+		writer.Header().Set("Content-Length", strconv.FormatInt(r.length(), 10))
+		writer.WriteHeader(http.StatusPartialContent)
+		writer.Write(buf[r.start : r.end+1])
+		return true
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for _, r := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {r.contentRange(size)},
+		})
+		if err != nil {
+			panic(err) // cannot happen for an in-memory buffer
+		}
+		part.Write(buf[r.start : r.end+1])
+	}
+	mw.Close()
+
+	writer.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	writer.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	writer.WriteHeader(http.StatusPartialContent)
+	writer.Write(body.Bytes())
+	return true
+}
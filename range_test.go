@@ -0,0 +1,175 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLastMod = time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+
+// testHandler serves a single text resource /a.txt with the given content and testLastMod.
+func testHandler(content string) (http.Handler, *Resource) {
+	res := NewResourceFromBytes("/a.txt", []byte(content))
+	res.lastMod = testLastMod
+	return newHandler("/", []*Resource{res}), res
+}
+
+// serve performs the request with the given header key value pairs.
+func serve(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   []byteRange
+		err    string // empty, unsatisfiable or invalid
+	}{
+		{header: "bytes=0-9", size: 100, want: []byteRange{{0, 9}}},
+		{header: "bytes= 5 - 5 ", size: 100, want: []byteRange{{5, 5}}},
+		{header: "bytes=-10", size: 100, want: []byteRange{{90, 99}}},
+		{header: "bytes=-200", size: 100, want: []byteRange{{0, 99}}},
+		{header: "bytes=90-", size: 100, want: []byteRange{{90, 99}}},
+		{header: "bytes=90-200", size: 100, want: []byteRange{{90, 99}}},
+		{header: "bytes=0-0, 10-19,-1", size: 100, want: []byteRange{{0, 0}, {10, 19}, {99, 99}}},
+		{header: "bytes=0-1,200-", size: 100, want: []byteRange{{0, 1}}},
+		{header: "bytes=100-", size: 100, err: "unsatisfiable"},
+		{header: "bytes=100-200,300-", size: 100, err: "unsatisfiable"},
+		{header: "bytes=-0", size: 100, err: "unsatisfiable"},
+		{header: "bytes=-5", size: 0, err: "unsatisfiable"},
+		{header: "bytes=0-", size: 0, err: "unsatisfiable"},
+		{header: "items=0-1", size: 100, err: "invalid"},
+		{header: "bytes=abc", size: 100, err: "invalid"},
+		{header: "bytes=5", size: 100, err: "invalid"},
+		{header: "bytes=5-1", size: 100, err: "invalid"},
+		{header: "bytes=1-x", size: 100, err: "invalid"},
+		{header: "bytes=--1", size: 100, err: "invalid"},
+		{header: "bytes=-1-2", size: 100, err: "invalid"},
+		{header: "bytes=0-1,x", size: 100, err: "invalid"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, tt.size)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("parseRange(%q, %d): unexpected error %v", tt.header, tt.size, err)
+		case tt.err == "unsatisfiable" && err != errUnsatisfiableRange:
+			t.Errorf("parseRange(%q, %d): expected unsatisfiable but got %v, %v", tt.header, tt.size, got, err)
+		case tt.err == "invalid" && (err == nil || err == errUnsatisfiableRange):
+			t.Errorf("parseRange(%q, %d): expected invalid but got %v, %v", tt.header, tt.size, got, err)
+		case tt.err == "" && !reflect.DeepEqual(got, tt.want):
+			t.Errorf("parseRange(%q, %d): expected %v but got %v", tt.header, tt.size, tt.want, got)
+		}
+	}
+}
+
+func TestServeRange(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	h, res := testHandler(content)
+	etag := res.etag(EncodingIdentity)
+	date := testLastMod.Format(http.TimeFormat)
+
+	tests := []struct {
+		name         string
+		method       string
+		header       []string
+		status       int
+		body         string // checked unless empty
+		contentRange string // checked unless empty
+	}{
+		{name: "single", header: []string{"Range", "bytes=0-3"}, status: 206, body: "0123", contentRange: "bytes 0-3/20"},
+		{name: "suffix", header: []string{"Range", "bytes=-2"}, status: 206, body: "ij", contentRange: "bytes 18-19/20"},
+		{name: "open ended", header: []string{"Range", "bytes=15-"}, status: 206, body: "fghij", contentRange: "bytes 15-19/20"},
+		{name: "overlong", header: []string{"Range", "bytes=18-100"}, status: 206, body: "ij", contentRange: "bytes 18-19/20"},
+		{name: "multiple", header: []string{"Range", "bytes=0-1,5-6"}, status: 206},
+		{name: "more than the representation", header: []string{"Range", "bytes=0-,0-"}, status: 200, body: content},
+		{name: "unsatisfiable", header: []string{"Range", "bytes=20-"}, status: 416, contentRange: "bytes */20"},
+		{name: "malformed", header: []string{"Range", "bytes=x-y"}, status: 200, body: content},
+		{name: "unknown unit", header: []string{"Range", "items=0-1"}, status: 200, body: content},
+		{name: "if-range etag", header: []string{"Range", "bytes=0-3", "If-Range", etag}, status: 206, body: "0123"},
+		{name: "if-range other etag", header: []string{"Range", "bytes=0-3", "If-Range", `"other"`}, status: 200, body: content},
+		{name: "if-range weak etag", header: []string{"Range", "bytes=0-3", "If-Range", "W/" + etag}, status: 200, body: content},
+		{name: "if-range date", header: []string{"Range", "bytes=0-3", "If-Range", date}, status: 206, body: "0123"},
+		{name: "if-range other date", header: []string{"Range", "bytes=0-3", "If-Range", testLastMod.Add(time.Hour).Format(http.TimeFormat)}, status: 200, body: content},
+		{name: "if-range invalid date", header: []string{"Range", "bytes=0-3", "If-Range", "yesterday"}, status: 200, body: content},
+		{name: "head", method: http.MethodHead, header: []string{"Range", "bytes=0-3"}, status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			rec := serve(h, method, "/a.txt", tt.header...)
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, rec.Code)
+			}
+
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected body %q but got %q", tt.body, rec.Body.String())
+			}
+
+			if tt.contentRange != "" && rec.Header().Get("Content-Range") != tt.contentRange {
+				t.Errorf("expected Content-Range %q but got %q", tt.contentRange, rec.Header().Get("Content-Range"))
+			}
+		})
+	}
+}
+
+func TestServeRangeMultipart(t *testing.T) {
+	h, _ := testHandler("0123456789abcdefghij")
+	rec := serve(h, http.MethodGet, "/a.txt", "Range", "bytes=0-1,5-6")
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "multipart/byteranges; boundary=") {
+		t.Fatalf("unexpected Content-Type %q", rec.Header().Get("Content-Type"))
+	}
+
+	for _, part := range []string{"Content-Range: bytes 0-1/20", "01", "Content-Range: bytes 5-6/20", "56"} {
+		if !strings.Contains(rec.Body.String(), part) {
+			t.Errorf("expected %q in body %q", part, rec.Body.String())
+		}
+	}
+}
+
+func TestServeRangeHead(t *testing.T) {
+	h, _ := testHandler("0123456789abcdefghij")
+	rec := serve(h, http.MethodHead, "/a.txt", "Range", "bytes=0-3")
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no body but got %q", rec.Body.String())
+	}
+
+	if rec.Header().Get("Content-Length") != "20" {
+		t.Errorf("expected the full Content-Length but got %q", rec.Header().Get("Content-Length"))
+	}
+
+	if rec.Header().Get("Content-Range") != "" {
+		t.Errorf("unexpected Content-Range %q", rec.Header().Get("Content-Range"))
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// Report describes the changes, which a generator run would apply to the existing generated file.
+type Report struct {
+	Bundle    string        `json:"bundle,omitempty"` // name of the bundle within a Config
+	File      string        `json:"file"`
+	UpToDate  bool          `json:"upToDate"` // true, if the bundle version has not changed
+	Added     []ReportEntry `json:"added"`
+	Removed   []ReportEntry `json:"removed"`
+	Modified  []ReportEntry `json:"modified"`
+	Unchanged int           `json:"unchanged"` // amount of resources without changes
+}
+
+// ReportEntry describes a single resource. Old values are zero for added and new values are zero for
+// removed resources. Compressed sizes are the sizes of the embedded streams of the storage codec.
+type ReportEntry struct {
+	Name              string `json:"name"`
+	OldSize           int64  `json:"oldSize"`
+	NewSize           int64  `json:"newSize"`
+	OldCompressedSize int64  `json:"oldCompressedSize"`
+	NewCompressedSize int64  `json:"newCompressedSize"`
+	OldSha256         string `json:"oldSha256,omitempty"`
+	NewSha256         string `json:"newSha256,omitempty"`
+}
+
+// DryRun generates the bundle in memory and compares it with the existing generated file, without
+// writing anything.
+func DryRun(opts Options) (*Report, error) {
+	return dryRun(opts, nil)
+}
+
+// DryRun is like the package level DryRun, for the given named bundles or all declared bundles, if no names
+// are given.
+func (c *Config) DryRun(names ...string) ([]*Report, error) {
+	bundles, err := c.selectBundles(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*Report
+	for _, b := range bundles {
+		report, err := dryRun(b.options(), c.raw)
+		if err != nil {
+			return nil, fmt.Errorf("bundle '%s': %w", b.Name, err)
+		}
+		report.Bundle = b.Name
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func dryRun(opts Options, config []byte) (*Report, error) {
+	p, err := newPlan(opts, config)
+	if err != nil {
+		return nil, err
+	}
+
+	src, _, err := p.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	old := &genFile{}
+	if _, err := os.Stat(p.targetFile); err == nil {
+		old, err = parseGenFile(p.targetFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{
+		File:     p.targetFile,
+		UpToDate: old.Version == p.requiredHash,
+		Added:    []ReportEntry{},
+		Removed:  []ReportEntry{},
+		Modified: []ReportEntry{},
+	}
+
+	newResources := map[string]bool{}
+	for _, r := range src.Resources {
+		newResources[r.Name] = true
+		entry := ReportEntry{
+			Name:              r.Name,
+			NewSize:           r.Size,
+			NewCompressedSize: r.Compressed,
+			NewSha256:         r.Sha265,
+		}
+
+		oldRes, ok := old.Resources[r.Name]
+		if !ok {
+			report.Added = append(report.Added, entry)
+			continue
+		}
+
+		entry.OldSize = oldRes.Size
+		entry.OldCompressedSize = old.compressedSize(oldRes)
+		entry.OldSha256 = oldRes.Sha256
+		if entry.OldSha256 == entry.NewSha256 {
+			report.Unchanged++
+			continue
+		}
+
+		report.Modified = append(report.Modified, entry)
+	}
+
+	for name, oldRes := range old.Resources {
+		if newResources[name] {
+			continue
+		}
+
+		report.Removed = append(report.Removed, ReportEntry{
+			Name:              name,
+			OldSize:           oldRes.Size,
+			OldCompressedSize: old.compressedSize(oldRes),
+			OldSha256:         oldRes.Sha256,
+		})
+	}
+
+	for _, entries := range [][]ReportEntry{report.Added, report.Removed, report.Modified} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+	}
+
+	return report, nil
+}
+
+// compressedSize returns the length of the embedded compressed stream or 0, if unknown.
+func (g *genFile) compressedSize(r genResource) (size int64) {
+	data, ok := g.Blobs[r.ConstName]
+	if !ok {
+		return 0
+	}
+
+	defer func() {
+		if recover() != nil {
+			size = 0 // the blob has been corrupted, which is reported by Check
+		}
+	}()
+
+	return int64(len(mustDecodeBlob(r.Encoding, data)))
+}
+
+// WriteJSON writes the report as indented json.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report as a human readable table.
+func (r *Report) WriteText(w io.Writer) error {
+	title := r.File
+	if r.Bundle != "" {
+		title = r.Bundle + " (" + r.File + ")"
+	}
+
+	status := "needs regeneration"
+	if r.UpToDate {
+		status = "up to date"
+	}
+
+	if _, err := fmt.Fprintf(w, "%s: %s, %d added, %d removed, %d modified, %d unchanged\n", title, status,
+		len(r.Added), len(r.Removed), len(r.Modified), r.Unchanged); err != nil {
+		return err
+	}
+
+	if len(r.Added)+len(r.Removed)+len(r.Modified) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tname\tsize\tcompressed\tsha256\t")
+	for _, group := range []struct {
+		sign    string
+		entries []ReportEntry
+	}{{"+", r.Added}, {"-", r.Removed}, {"~", r.Modified}} {
+		for _, e := range group.entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", group.sign, e.Name,
+				change(fmt.Sprint(e.OldSize), fmt.Sprint(e.NewSize), e.OldSha256 == "", e.NewSha256 == ""),
+				change(fmt.Sprint(e.OldCompressedSize), fmt.Sprint(e.NewCompressedSize), e.OldSha256 == "", e.NewSha256 == ""),
+				change(shortHash(e.OldSha256), shortHash(e.NewSha256), e.OldSha256 == "", e.NewSha256 == ""))
+		}
+	}
+
+	return tw.Flush()
+}
+
+// change formats an old and a new value, omitting the one which does not exist.
+func change(old, new string, noOld, noNew bool) string {
+	switch {
+	case noOld:
+		return new
+	case noNew:
+		return old
+	default:
+		return old + " -> " + new
+	}
+}
+
+func shortHash(hash string) string {
+	if len(hash) > minFingerprintLen {
+		return hash[:minFingerprintLen]
+	}
+	return hash
+}
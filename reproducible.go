@@ -0,0 +1,126 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The supported values of Options.ModTime. Like file modification times, a changed time alone never causes a
+// regeneration, because only the contents and the options determine the bundle version.
+const (
+	// ModTimeFile keeps the modification time of each file. This is the default.
+	ModTimeFile = ""
+	// ModTimeEpoch sets all modification times to the unix epoch.
+	ModTimeEpoch = "epoch"
+	// ModTimeSourceDateEpoch sets all modification times to the SOURCE_DATE_EPOCH environment variable, which
+	// must be set, see https://reproducible-builds.org/specs/source-date-epoch/.
+	ModTimeSourceDateEpoch = "source-date-epoch"
+	// ModTimeGit sets all modification times to the time of the latest git commit, which touches any of the
+	// included paths. To keep the time independent of when the file is generated, the generator refuses to run
+	// while the included paths have uncommitted changes. Commit changed files first and regenerate afterwards,
+	// so that the generated file carries the time of that commit.
+	ModTimeGit = "git"
+)
+
+// SourceDateEpochEnv is the environment variable used by ModTimeSourceDateEpoch.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// resolveModTime returns the time, which replaces all file modification times or nil, if they are kept.
+func resolveModTime(cwd string, opts Options) (*time.Time, error) {
+	var t time.Time
+	switch opts.ModTime {
+	case ModTimeFile:
+		return nil, nil
+	case ModTimeEpoch:
+		t = time.Unix(0, 0)
+	case ModTimeSourceDateEpoch:
+		value, ok := os.LookupEnv(SourceDateEpochEnv)
+		if !ok {
+			return nil, fmt.Errorf("modTime %s requires the %s environment variable", ModTimeSourceDateEpoch, SourceDateEpochEnv)
+		}
+
+		sec, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", SourceDateEpochEnv, err)
+		}
+		t = time.Unix(sec, 0)
+	case ModTimeGit:
+		sec, err := gitCommitTime(cwd, opts.Include)
+		if err != nil {
+			return nil, err
+		}
+		t = time.Unix(sec, 0)
+	default:
+		return nil, fmt.Errorf("unsupported modTime '%s', expected %s, %s or %s", opts.ModTime, ModTimeEpoch,
+			ModTimeSourceDateEpoch, ModTimeGit)
+	}
+
+	return &t, nil
+}
+
+// gitCommitTime returns the unix time of the latest commit, which touches any of the given paths. It fails, if
+// the paths have uncommitted changes, because the time of the next commit is not known yet.
+func gitCommitTime(cwd string, paths []string) (int64, error) {
+	status, err := git(cwd, append([]string{"status", "--porcelain", "--"}, paths...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	if status != "" {
+		return 0, fmt.Errorf("modTime %s: the included files have uncommitted changes, commit them first:\n%s",
+			ModTimeGit, status)
+	}
+
+	value, err := git(cwd, append([]string{"log", "-1", "--format=%ct", "--"}, paths...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	if value == "" {
+		return 0, fmt.Errorf("modTime %s: no commit touches the included files, commit them first", ModTimeGit)
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// git runs the git command in the given dir and returns its trimmed output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// normalizeMode reduces the mode to what git can represent, i.e. 0755 for executable and 0644 for all
+// other files, so that the result does not depend on the umask of a checkout.
+func normalizeMode(mode os.FileMode) os.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
@@ -17,7 +17,10 @@ package bundle
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
 	"sync"
@@ -28,18 +31,54 @@ import (
 // A Resource relates a bunch of bytes with a name and optionally cached variants of the same data.
 type Resource struct {
 	name              string
-	encoded           string // brotli + asci85
+	encoded           string // compressed by codec + blob encoding
+	codec             string // name of the storage codec, empty for the DefaultCodec
+	encoding          string // blob encoding of encoded and encodedGzip, empty for ascii85
+	encodedGzip       string // optional gzip variant + blob encoding, embedded by the generator
 	size              int64  // original size
 	cacheUnpacked     []byte
-	cacheBrotli       []byte
-	cacheGzip         []byte
+	variants          map[string][]byte // cached compressed variants by content coding
+	noCache           map[string]bool   // content codings, whose variants must not be cached
 	mustCacheUnpacked bool
-	mustCacheBrotli   bool
-	mustCacheGzip     bool
 	mutex             sync.Mutex
 	mode              os.FileMode
 	lastMod           time.Time
 	sha256String      string
+	sha384Base64      string
+	sha512Base64      string
+	source            string // slash separated path of the original file, relative to the module root
+}
+
+// Meta contains optional information about a resource, which is recorded by the generator, so that it
+// does not need to be recomputed at runtime.
+type Meta struct {
+	Sha384 string // base64 encoded sha384 digest of the unpacked data
+	Sha512 string // base64 encoded sha512 digest of the unpacked data
+	Source string // slash separated path of the original file relative to the module root, used in development mode
+	Codec  string // name of the registered codec, which compressed the data, empty for the DefaultCodec or identity if stored
+	Gzip   string // optional encoded gzip variant, so that it is not compressed at runtime
+
+	// Encoding is the text encoding of the data and the gzip variant, i.e. ascii85, base64, base122 or raw.
+	// It defaults to ascii85.
+	Encoding string
+
+	// DisableCache lists additional content codings, whose compressed variants are not kept in memory.
+	DisableCache []string
+}
+
+// WithMeta applies the given meta data and returns the same resource. It is intended to be chained
+// to NewResource by the generated code and must not be called concurrently with other methods.
+func (r *Resource) WithMeta(meta Meta) *Resource {
+	r.sha384Base64 = meta.Sha384
+	r.sha512Base64 = meta.Sha512
+	r.source = meta.Source
+	r.codec = meta.Codec
+	r.encodedGzip = meta.Gzip
+	r.encoding = meta.Encoding
+	for _, coding := range meta.DisableCache {
+		r.noCache[coding] = true
+	}
+	return r
 }
 
 func NewResource(name string, size int64, mode os.FileMode, lastMod time.Time, sha256 string, cacheUnpacked, cacheBrotli, cacheGzip bool, data string) *Resource {
@@ -48,8 +87,8 @@ func NewResource(name string, size int64, mode os.FileMode, lastMod time.Time, s
 		encoded:           data,
 		size:              size,
 		mustCacheUnpacked: cacheUnpacked,
-		mustCacheBrotli:   cacheBrotli,
-		mustCacheGzip:     cacheGzip,
+		variants:          map[string][]byte{},
+		noCache:           map[string]bool{EncodingBrotli: !cacheBrotli, EncodingGzip: !cacheGzip},
 		mode:              mode,
 		lastMod:           lastMod,
 		sha256String:      sha256,
@@ -66,6 +105,36 @@ func NewResourceFromBytes(name string, buf []byte) *Resource {
 	return r
 }
 
+// rename returns a new resource with the given name, sharing the data and already cached variants.
+func (r *Resource) rename(name string) *Resource {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	variants := make(map[string][]byte, len(r.variants))
+	for coding, buf := range r.variants {
+		variants[coding] = buf
+	}
+
+	return &Resource{
+		name:              name,
+		encoded:           r.encoded,
+		codec:             r.codec,
+		encoding:          r.encoding,
+		encodedGzip:       r.encodedGzip,
+		size:              r.size,
+		cacheUnpacked:     r.cacheUnpacked,
+		variants:          variants,
+		noCache:           r.noCache, // never modified after construction
+		mustCacheUnpacked: r.mustCacheUnpacked,
+		mode:              r.mode,
+		lastMod:           r.lastMod,
+		sha256String:      r.sha256String,
+		sha384Base64:      r.sha384Base64,
+		sha512Base64:      r.sha512Base64,
+		source:            r.source,
+	}
+}
+
 func (r *Resource) Mode() os.FileMode {
 	return r.mode
 }
@@ -93,11 +162,18 @@ func (r *Resource) Size() int64 {
 }
 
 func (r *Resource) unpack() []byte {
-	if r.cacheUnpacked != nil {
-		return r.cacheUnpacked
+	r.mutex.Lock()
+	buf := r.cacheUnpacked
+	r.mutex.Unlock()
+	if buf != nil {
+		return buf
+	}
+
+	b := mustDecodeBlob(r.encoding, r.encoded)
+	if !r.stored() {
+		b = mustDecompress(mustCodec(r.codec), b)
 	}
 
-	b := mustBrotliDecompress(mustDecodeAscii85(r.encoded))
 	if r.mustCacheUnpacked {
 		// kind of double check idiom
 		r.mutex.Lock()
@@ -123,6 +199,58 @@ func (r *Resource) Version() string {
 	return r.sha256String
 }
 
+// Integrity returns the Subresource Integrity string for the given algorithm, which is one of sha256, sha384
+// or sha512, e.g. sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC. Digests which have not
+// been recorded by the generator are calculated once. It returns the empty string for other algorithms.
+func (r *Resource) Integrity(alg string) string {
+	switch alg {
+	case "sha256":
+		hash, err := hex.DecodeString(r.sha256String)
+		if err != nil {
+			return ""
+		}
+		return alg + "-" + base64.StdEncoding.EncodeToString(hash)
+	case "sha384":
+		return alg + "-" + r.digest(&r.sha384Base64, func(buf []byte) []byte {
+			hash := sha512.Sum384(buf)
+			return hash[:]
+		})
+	case "sha512":
+		return alg + "-" + r.digest(&r.sha512Base64, func(buf []byte) []byte {
+			hash := sha512.Sum512(buf)
+			return hash[:]
+		})
+	default:
+		return ""
+	}
+}
+
+// digest returns the base64 encoded digest from the given field or calculates and remembers it.
+func (r *Resource) digest(field *string, sum func(buf []byte) []byte) string {
+	r.mutex.Lock()
+	digest := *field
+	r.mutex.Unlock()
+
+	if digest == "" {
+		digest = base64.StdEncoding.EncodeToString(sum(r.unpack()))
+		r.mutex.Lock()
+		*field = digest
+		r.mutex.Unlock()
+	}
+
+	return digest
+}
+
+// etag returns the quoted strong entity tag of the given content coding. Each coding is a different
+// representation and needs its own tag, otherwise a shared cache may serve a brotli response to a client
+// without brotli support.
+func (r *Resource) etag(encoding string) string {
+	if encoding == EncodingIdentity || encoding == "" {
+		return `"` + r.sha256String + `"`
+	}
+	return `"` + r.sha256String + "-" + encoding + `"`
+}
+
 // AsBytes returns the internal byte sequence as a defensive copy
 func (r *Resource) AsBytes() []byte {
 	buf := r.unpack()
@@ -132,62 +260,67 @@ func (r *Resource) AsBytes() []byte {
 	return cpy
 }
 
-func (r *Resource) gzip() []byte {
-	if r.cacheGzip != nil {
-		return r.cacheGzip
+// variant returns the data compressed with the given registered codec. The variant of the storage codec and an
+// embedded gzip variant are just decoded, all others are compressed from the unpacked data.
+func (r *Resource) variant(coding string) []byte {
+	r.mutex.Lock()
+	buf, ok := r.variants[coding]
+	r.mutex.Unlock()
+	if ok {
+		return buf
 	}
 
-	buf := r.unpack()
-	buf = mustGzipCompress(buf)
-	if r.mustCacheGzip {
-		// kind of double check idiom
+	switch {
+	case len(r.encoded) > 0 && (coding == r.codec || r.codec == "" && coding == DefaultCodec):
+		buf = mustDecodeBlob(r.encoding, r.encoded)
+	case len(r.encodedGzip) > 0 && coding == EncodingGzip:
+		buf = mustDecodeBlob(r.encoding, r.encodedGzip)
+	default:
+		buf = mustCompress(mustCodec(coding), r.unpack()) // also for in-memory resources without serialized string variant
+	}
+
+	if !r.noCache[coding] {
 		r.mutex.Lock()
 		defer r.mutex.Unlock()
-		r.cacheGzip = buf
+		r.variants[coding] = buf
 	}
 	return buf
 }
 
-// ReadGzip opens the resource to read the data as gzip stream
-func (r *Resource) ReadGzip() io.Reader {
-	return bytes.NewReader(r.gzip())
-}
-
-func (r *Resource) brotli() []byte {
-	if r.cacheBrotli != nil {
-		return r.cacheBrotli
-	}
-
-	var buf []byte
-	if len(r.encoded) == 0 {
-		buf = r.unpack() // in-memory without serialized string variant
-		buf = mustBrotliCompress(buf)
-	} else {
-		buf = mustDecodeAscii85(r.encoded)
+// ReadEncoded opens the resource to read the data compressed with the given registered codec.
+func (r *Resource) ReadEncoded(coding string) (io.Reader, error) {
+	if _, ok := LookupCodec(coding); !ok {
+		return nil, fmt.Errorf("codec '%s' is not registered", coding)
 	}
+	return bytes.NewReader(r.variant(coding)), nil
+}
 
-	if r.mustCacheBrotli {
-		// kind of double check idiom
-		r.mutex.Lock()
-		defer r.mutex.Unlock()
-		r.cacheBrotli = buf
+// WriteEncoded writes the data compressed with the given registered codec into the writer.
+func (r *Resource) WriteEncoded(dst io.Writer, coding string) (int, error) {
+	if _, ok := LookupCodec(coding); !ok {
+		return 0, fmt.Errorf("codec '%s' is not registered", coding)
 	}
-	return buf
+	return dst.Write(r.variant(coding))
 }
 
 // ReadGzip opens the resource to read the data as gzip stream
+func (r *Resource) ReadGzip() io.Reader {
+	return bytes.NewReader(r.variant(EncodingGzip))
+}
+
+// ReadBrotli opens the resource to read the data as brotli stream
 func (r *Resource) ReadBrotli() io.Reader {
-	return bytes.NewReader(r.brotli())
+	return bytes.NewReader(r.variant(EncodingBrotli))
 }
 
 // WriteBrotli writes the datastream as a brotli buffer into the writer
 func (r *Resource) WriteBrotli(dst io.Writer) (int, error) {
-	return dst.Write(r.brotli())
+	return dst.Write(r.variant(EncodingBrotli))
 }
 
 // WriteGzip writes the datastream as a gzip buffer into the writer
 func (r *Resource) WriteGzip(dst io.Writer) (int, error) {
-	return dst.Write(r.gzip())
+	return dst.Write(r.variant(EncodingGzip))
 }
 
 // Write transfers the uncompressed data into the writer
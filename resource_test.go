@@ -0,0 +1,55 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestResourceConcurrentAccess is intended to be run with -race.
+func TestResourceConcurrentAccess(t *testing.T) {
+	content := strings.Repeat("hello bundle ", 100)
+	hash := sha256.Sum256([]byte(content))
+	data := mustEncodeBlob(BlobAscii85, mustCompress(mustCodec(DefaultCodec), []byte(content)))
+	res := NewResource("/a.txt", int64(len(content)), 0644, testLastMod, hex.EncodeToString(hash[:]), true, true, true, data)
+	h := newHandler("/", []*Resource{res})
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			coding := []string{"", "", EncodingBrotli, EncodingGzip}[i%4]
+			rec := serve(h, http.MethodGet, "/a.txt", "Accept-Encoding", coding)
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected 200 but got %d", rec.Code)
+			}
+
+			if coding == "" && rec.Body.String() != content {
+				t.Errorf("unexpected body %q", rec.Body.String())
+			}
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+}
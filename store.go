@@ -0,0 +1,70 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"path"
+	"strings"
+)
+
+// DefaultStoreExtensions are the file extensions of formats, which are already compressed, e.g. images,
+// fonts, audio, video and archives. Such files are stored without compression, if Options.StoreExtensions is nil.
+var DefaultStoreExtensions = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".heic", ".ico",
+	".woff", ".woff2",
+	".mp3", ".ogg", ".opus", ".m4a", ".aac", ".flac",
+	".mp4", ".m4v", ".webm", ".mov", ".mkv",
+	".zip", ".gz", ".tgz", ".bz2", ".xz", ".br", ".zst", ".7z", ".rar", ".jar",
+}
+
+// DefaultStoreRatio is used, if Options.StoreRatio is not set.
+const DefaultStoreRatio = 0.95
+
+// storeExtension returns true, if the name has one of the configured extensions of already compressed formats.
+func (o Options) storeExtension(name string) bool {
+	extensions := o.StoreExtensions
+	if extensions == nil {
+		extensions = DefaultStoreExtensions
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range extensions {
+		if strings.ToLower(e) == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keepCompressed returns true, if the compressed size is small enough to be worth decompressing.
+func (o Options) keepCompressed(size, compressed int64) bool {
+	ratio := o.StoreRatio
+	if ratio == 0 {
+		ratio = DefaultStoreRatio
+	}
+
+	if size == 0 || ratio >= 1 {
+		return true
+	}
+
+	return float64(compressed) <= float64(size)*ratio
+}
+
+// stored returns true, if the resource has been embedded without compression. It is only served with
+// identity encoding, because compressing it again would gain nothing.
+func (r *Resource) stored() bool {
+	return r.codec == EncodingIdentity
+}
@@ -49,5 +49,6 @@ var Bundle = bundle.Make(
 
 {{ range .Blobs }}
 const {{.ConstName}} = {{.Data}}
+{{ if .Gzip }}const {{.GzipConstName}} = {{.Gzip}}{{ end }}
 {{ end }}
 `
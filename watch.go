@@ -0,0 +1,270 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is used by Watch, if no positive interval is given.
+const DefaultWatchInterval = time.Second
+
+// Watch generates the bundle like Embed and keeps polling the included files in the given interval, until the
+// context is done. Changes are debounced by one interval, so that copying a bunch of files causes only a
+// single regeneration, which only happens if the bundle hash has changed. Each regeneration emits an
+// EventWritten with a summary of the added, removed and modified resources. Errors after the initial
+// generation are emitted as EventError but do not stop watching.
+func Watch(ctx context.Context, opts Options, interval time.Duration) error {
+	return watch(ctx, interval, &watcher{opts: opts})
+}
+
+// Watch is like the package level Watch, for the given named bundles or all declared bundles, if no names
+// are given.
+func (c *Config) Watch(ctx context.Context, interval time.Duration, names ...string) error {
+	bundles, err := c.selectBundles(names)
+	if err != nil {
+		return err
+	}
+
+	var watchers []*watcher
+	for _, b := range bundles {
+		watchers = append(watchers, &watcher{name: b.Name, opts: b.options(), config: c.raw})
+	}
+
+	return watch(ctx, interval, watchers...)
+}
+
+func watch(ctx context.Context, interval time.Duration, watchers ...*watcher) error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	for _, w := range watchers {
+		if err := w.init(); err != nil {
+			return w.wrap(err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, w := range watchers {
+				if err := w.poll(); err != nil {
+					w.opts.emit(Event{Kind: EventError, Err: err})
+				}
+			}
+		}
+	}
+}
+
+// watcher tracks the state of a single bundle.
+type watcher struct {
+	name      string // optional name of the bundle within a Config
+	opts      Options
+	config    []byte
+	snapshot  string            // cheap modification state of all included files
+	dirty     bool              // snapshot has changed within the last interval
+	hash      string            // bundle hash of the generated file
+	resources map[string]string // resource name to sha256 hex of the generated file
+}
+
+func (w *watcher) wrap(err error) error {
+	if w.name == "" {
+		return err
+	}
+	return fmt.Errorf("bundle '%s': %w", w.name, err)
+}
+
+// init generates the bundle if required and remembers the initial state.
+func (w *watcher) init() error {
+	snapshot, err := w.takeSnapshot()
+	if err != nil {
+		return err
+	}
+
+	w.snapshot = snapshot
+	return w.regenerate()
+}
+
+// poll regenerates the bundle, if the included files have been modified and stayed unchanged since the last poll.
+func (w *watcher) poll() error {
+	snapshot, err := w.takeSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if snapshot != w.snapshot {
+		w.snapshot = snapshot
+		w.dirty = true
+		return nil
+	}
+
+	if !w.dirty {
+		return nil
+	}
+
+	w.dirty = false
+	return w.regenerate()
+}
+
+// takeSnapshot stats all included files, which is much cheaper than hashing them.
+func (w *watcher) takeSnapshot() (string, error) {
+	cwd, err := modRoot()
+	if err != nil {
+		return "", err
+	}
+
+	files, err := collectFiles(cwd, w.opts)
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(files)
+	sb := &strings.Builder{}
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(sb, "%s:%d:%d;", file, stat.ModTime().UnixNano(), stat.Size())
+	}
+
+	return sb.String(), nil
+}
+
+// regenerate writes the bundle, if its hash has changed and prints a summary.
+func (w *watcher) regenerate() error {
+	p, err := newPlan(w.opts, w.config)
+	if err != nil {
+		return err
+	}
+
+	if p.requiredHash == w.hash {
+		return nil
+	}
+
+	resources, err := p.resourceHashes()
+	if err != nil {
+		return err
+	}
+
+	foundHash, err := extractFileHash(p.targetFile)
+	if err != nil {
+		return err
+	}
+
+	if p.requiredHash != foundHash {
+		src, formatted, err := p.generate()
+		if err != nil {
+			return err
+		}
+
+		var details string
+		if w.resources != nil {
+			details = diffResources(w.resources, resources).String()
+		}
+
+		if err := p.write(src, formatted, details); err != nil {
+			return err
+		}
+	}
+
+	w.hash = p.requiredHash
+	w.resources = resources
+	return nil
+}
+
+// resourceHashes returns the sha256 hex of each resource by name.
+func (p *plan) resourceHashes() (map[string]string, error) {
+	res := make(map[string]string, len(p.files))
+	for _, file := range p.files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := sha256.Sum256(buf)
+		res[p.nameOf(file)] = hex.EncodeToString(hash[:])
+	}
+
+	return res, nil
+}
+
+// resourceDiff lists the names of the resources, which differ between two states.
+type resourceDiff struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// diffResources compares two maps of resource names to content hashes.
+func diffResources(old, new map[string]string) resourceDiff {
+	var diff resourceDiff
+	for name, hash := range new {
+		oldHash, ok := old[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case oldHash != hash:
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+
+	return diff
+}
+
+func (d resourceDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// String returns a concise description of the differences.
+func (d resourceDiff) String() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%d added, %d removed, %d modified", len(d.Added), len(d.Removed), len(d.Modified))
+	for _, name := range d.Added {
+		sb.WriteString("\n  + " + name)
+	}
+	for _, name := range d.Removed {
+		sb.WriteString("\n  - " + name)
+	}
+	for _, name := range d.Modified {
+		sb.WriteString("\n  ~ " + name)
+	}
+
+	return sb.String()
+}